@@ -0,0 +1,155 @@
+package activitypub
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultGoneTTL : Expiration of gone actor mark when GoneTTL is not set.
+const DefaultGoneTTL = 24 * time.Hour
+
+type cacheEntry struct {
+	url     string
+	data    []byte
+	expires time.Time
+}
+
+// ActorCache : Actor cache shared in redis with in-process LRU layer.
+type ActorCache struct {
+	RedisClient *redis.Client
+	TTL         time.Duration
+	GoneTTL     time.Duration
+
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	gone    map[string]time.Time
+}
+
+// NewActorCache : Create ActorCache keeps size entries in-process.
+func NewActorCache(redisClient *redis.Client, size int, ttl time.Duration) *ActorCache {
+	return &ActorCache{
+		RedisClient: redisClient,
+		TTL:         ttl,
+		size:        size,
+		entries:     map[string]*list.Element{},
+		order:       list.New(),
+		gone:        map[string]time.Time{},
+	}
+}
+
+// Get : Get cached actor document.
+func (cache *ActorCache) Get(url string) ([]byte, bool) {
+	cache.mutex.Lock()
+	if element, ok := cache.entries[url]; ok {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			cache.order.MoveToFront(element)
+			cache.mutex.Unlock()
+			return entry.data, true
+		}
+		cache.order.Remove(element)
+		delete(cache.entries, url)
+	}
+	cache.mutex.Unlock()
+
+	if cache.RedisClient == nil {
+		return nil, false
+	}
+	data, err := cache.RedisClient.Get("relay:actor:" + url).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	ttl, err := cache.RedisClient.TTL("relay:actor:" + url).Result()
+	if err != nil || ttl <= 0 {
+		ttl = cache.TTL
+	}
+	cache.setLocal(url, data, ttl)
+	return data, true
+}
+
+// Set : Store actor document.
+func (cache *ActorCache) Set(url string, data []byte) {
+	cache.setLocal(url, data, cache.TTL)
+	if cache.RedisClient != nil {
+		cache.RedisClient.Set("relay:actor:"+url, data, cache.TTL)
+	}
+}
+
+// Delete : Invalidate actor document.
+func (cache *ActorCache) Delete(url string) {
+	cache.mutex.Lock()
+	if element, ok := cache.entries[url]; ok {
+		cache.order.Remove(element)
+		delete(cache.entries, url)
+	}
+	cache.mutex.Unlock()
+	if cache.RedisClient != nil {
+		cache.RedisClient.Del("relay:actor:" + url)
+	}
+}
+
+// MarkGone : Remember actor document returns 410, it is not fetched until mark expires.
+func (cache *ActorCache) MarkGone(url string) {
+	cache.Delete(url)
+	url = strings.SplitN(url, "#", 2)[0]
+	ttl := cache.GoneTTL
+	if ttl <= 0 {
+		ttl = DefaultGoneTTL
+	}
+	if cache.size > 0 {
+		now := time.Now()
+		cache.mutex.Lock()
+		for marked, expires := range cache.gone {
+			if !now.Before(expires) {
+				delete(cache.gone, marked)
+			}
+		}
+		cache.gone[url] = now.Add(ttl)
+		cache.mutex.Unlock()
+	}
+	if cache.RedisClient != nil {
+		cache.RedisClient.Set("relay:actor:gone:"+url, 1, ttl)
+	}
+}
+
+// IsGone : Check actor is marked as gone.
+func (cache *ActorCache) IsGone(url string) bool {
+	url = strings.SplitN(url, "#", 2)[0]
+	cache.mutex.Lock()
+	expires, ok := cache.gone[url]
+	cache.mutex.Unlock()
+	if ok && time.Now().Before(expires) {
+		return true
+	}
+	if cache.RedisClient == nil {
+		return false
+	}
+	gone, _ := cache.RedisClient.Exists("relay:actor:gone:" + url).Result()
+	return gone == 1
+}
+
+func (cache *ActorCache) setLocal(url string, data []byte, ttl time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.size <= 0 {
+		return
+	}
+	entry := &cacheEntry{url, data, time.Now().Add(ttl)}
+	if element, ok := cache.entries[url]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[url] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).url)
+	}
+}
@@ -0,0 +1,29 @@
+package activitypub
+
+import (
+	"testing"
+)
+
+func TestActorCacheGoneMark(t *testing.T) {
+	cache := NewActorCache(nil, 2, DefaultGoneTTL)
+
+	cache.MarkGone("https://example.jp/users/gone#main-key")
+	if !cache.IsGone("https://example.jp/users/gone") {
+		t.Fatalf("Failed - Actor is not marked as gone")
+	}
+	if _, ok := cache.Get("https://example.jp/users/gone"); ok {
+		t.Fatalf("Failed - Gone actor is cached as document")
+	}
+	if !cache.IsGone("https://example.jp/users/gone") {
+		t.Fatalf("Failed - Gone mark is removed by Get")
+	}
+
+	cache.Set("https://example.jp/users/a", []byte("a"))
+	cache.Set("https://example.jp/users/b", []byte("b"))
+	if !cache.IsGone("https://example.jp/users/gone") {
+		t.Fatalf("Failed - Gone mark is evicted by cached documents")
+	}
+	if data, ok := cache.Get("https://example.jp/users/a"); !ok || string(data) != "a" {
+		t.Fatalf("Failed - Cached document is not returned")
+	}
+}
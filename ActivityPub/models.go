@@ -1,19 +1,178 @@
 package activitypub
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
-	cache "github.com/patrickmn/go-cache"
 	uuid "github.com/satori/go.uuid"
 	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
+	"github.com/yukimochi/httpsig"
 )
 
+// Strings : Property given as single value or array (to, cc), embedded objects are reduced to ID.
+type Strings []string
+
+// UnmarshalJSON : Accept single value or array.
+func (values *Strings) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*values = nil
+	switch value := value.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range value {
+			if id := linkID(item); id != "" {
+				*values = append(*values, id)
+			}
+		}
+	default:
+		if id := linkID(value); id != "" {
+			*values = Strings{id}
+		}
+	}
+	return nil
+}
+
+// Link : Property given as ID or embedded object (actor, attributedTo), embedded object is reduced to ID.
+type Link string
+
+// UnmarshalJSON : Accept ID, embedded object or array of them, first one is taken from array.
+func (link *Link) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	if values, ok := value.([]interface{}); ok {
+		value = nil
+		if len(values) > 0 {
+			value = values[0]
+		}
+	}
+	*link = Link(linkID(value))
+	return nil
+}
+
+// LinkOrObject : ID or embedded object, ID of embedded object is taken from its id (or href of Link object).
+type LinkOrObject struct {
+	ID       string
+	Embedded json.RawMessage
+}
+
+// MarshalJSON : Embedded object as it is given, otherwise ID.
+func (object LinkOrObject) MarshalJSON() ([]byte, error) {
+	if len(object.Embedded) > 0 {
+		return object.Embedded, nil
+	}
+	return json.Marshal(object.ID)
+}
+
+// UnmarshalJSON : Accept ID or embedded object, other values are taken as empty.
+func (object *LinkOrObject) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*object = LinkOrObject{ID: linkID(value)}
+	if _, ok := value.(map[string]interface{}); ok {
+		var embedded bytes.Buffer
+		err = json.Compact(&embedded, data)
+		if err != nil {
+			return err
+		}
+		object.Embedded = embedded.Bytes()
+	}
+	return nil
+}
+
+// Decode : Decode embedded object into value, error if object is given as ID.
+func (object LinkOrObject) Decode(value interface{}) error {
+	if len(object.Embedded) == 0 {
+		return errors.New("Object is not embedded")
+	}
+	return json.Unmarshal(object.Embedded, value)
+}
+
+// Objects : Property given as ID, embedded object or array of them (object), single one is marshaled without array.
+type Objects []LinkOrObject
+
+// MarshalJSON : Single object without array, otherwise array.
+func (objects Objects) MarshalJSON() ([]byte, error) {
+	if len(objects) == 1 {
+		return json.Marshal(objects[0])
+	}
+	return json.Marshal([]LinkOrObject(objects))
+}
+
+// UnmarshalJSON : Accept ID, embedded object or array of them.
+func (objects *Objects) UnmarshalJSON(data []byte) error {
+	var values []json.RawMessage
+	if json.Unmarshal(data, &values) != nil {
+		values = []json.RawMessage{data}
+	}
+	*objects = nil
+	for _, value := range values {
+		var object LinkOrObject
+		err := json.Unmarshal(value, &object)
+		if err != nil {
+			return err
+		}
+		if object.ID != "" || len(object.Embedded) > 0 {
+			*objects = append(*objects, object)
+		}
+	}
+	return nil
+}
+
+// LinkTo : Objects given as ID.
+func LinkTo(ids ...string) Objects {
+	var objects Objects
+	for _, id := range ids {
+		objects = append(objects, LinkOrObject{ID: id})
+	}
+	return objects
+}
+
+// Embed : Object embedded, value is marshaled as JSON object.
+func Embed(value interface{}) Objects {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var object LinkOrObject
+	err = json.Unmarshal(data, &object)
+	if err != nil || len(object.Embedded) == 0 {
+		return nil
+	}
+	return Objects{object}
+}
+
+func linkID(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case map[string]interface{}:
+		if id, ok := value["id"].(string); ok {
+			return id
+		}
+		// Link object
+		href, _ := value["href"].(string)
+		return href
+	}
+	return ""
+}
+
 // PublicKey : Activity Certificate.
 type PublicKey struct {
 	ID           string `json:"id,omitempty"`
@@ -21,7 +180,7 @@ type PublicKey struct {
 	PublicKeyPem string `json:"publicKeyPem,omitempty"`
 }
 
-//Endpoints : Contains SharedInbox address.
+// Endpoints : Contains SharedInbox address.
 type Endpoints struct {
 	SharedInbox string `json:"sharedInbox,omitempty"`
 }
@@ -40,10 +199,14 @@ type Actor struct {
 	PreferredUsername string      `json:"preferredUsername,omitempty"`
 	Summary           string      `json:"summary,omitempty"`
 	Inbox             string      `json:"inbox,omitempty"`
+	Outbox            string      `json:"outbox,omitempty"`
+	Followers         string      `json:"followers,omitempty"`
+	Following         string      `json:"following,omitempty"`
 	Endpoints         *Endpoints  `json:"endpoints,omitempty"`
 	PublicKey         PublicKey   `json:"publicKey,omitempty"`
 	Icon              Image       `json:"icon,omitempty"`
 	Image             Image       `json:"image,omitempty"`
+	AlsoKnownAs       Strings     `json:"alsoKnownAs,omitempty"`
 }
 
 // GenerateSelfKey : Generate relay Actor from Publickey.
@@ -53,6 +216,9 @@ func (actor *Actor) GenerateSelfKey(hostname *url.URL, publickey *rsa.PublicKey)
 	actor.Type = "Service"
 	actor.PreferredUsername = "relay"
 	actor.Inbox = hostname.String() + "/inbox"
+	actor.Outbox = hostname.String() + "/outbox"
+	actor.Followers = hostname.String() + "/actor/followers"
+	actor.Following = hostname.String() + "/actor/following"
 	actor.PublicKey = PublicKey{
 		hostname.String() + "/actor#main-key",
 		hostname.String() + "/actor",
@@ -60,38 +226,86 @@ func (actor *Actor) GenerateSelfKey(hostname *url.URL, publickey *rsa.PublicKey)
 	}
 }
 
-// RetrieveRemoteActor : Retrieve Actor from remote instance.
-func (actor *Actor) RetrieveRemoteActor(url string, uaString string, cache *cache.Cache) error {
+// ErrGone : Remote object is deleted, respond 410 Gone.
+var ErrGone = errors.New("410 Gone")
+
+// FetchKey : Relay's key to sign GET request for authorized fetch.
+type FetchKey struct {
+	KeyID      string
+	PrivateKey *rsa.PrivateKey
+}
+
+// SignRequest : Sign GET request with HTTP Signature.
+func (key *FetchKey) SignRequest(request *http.Request) error {
+	request.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	request.Header.Set("Host", request.URL.Host)
+	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, []string{httpsig.RequestTarget, "Host", "Date"}, httpsig.Signature)
+	if err != nil {
+		return err
+	}
+	return signer.SignRequest(key.PrivateKey, key.KeyID, request)
+}
+
+// HTTPClient : Client to retrieve remote objects, replaced by shared client of relay.
+var HTTPClient = &http.Client{Timeout: time.Duration(10) * time.Second}
+
+// RetrieveRemoteObject : Retrieve Object from remote instance, request is signed if key is given.
+func RetrieveRemoteObject(url string, uaString string, key *FetchKey) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	req.Header.Set("User-Agent", uaString)
+	if key != nil {
+		err = key.SignRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 410 {
+		return nil, ErrGone
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RetrieveRemoteActor : Retrieve Actor from remote instance, ErrGone is returned without fetch for gone actor.
+func (actor *Actor) RetrieveRemoteActor(url string, uaString string, cache *ActorCache, key *FetchKey) error {
 	var err error
 	cacheData, found := cache.Get(url)
 	if found {
-		err = json.Unmarshal(cacheData.([]byte), &actor)
+		err = json.Unmarshal(cacheData, &actor)
 		if err != nil {
 			cache.Delete(url)
 		} else {
 			return nil
 		}
 	}
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Accept", "application/activity+json")
-	req.Header.Set("User-Agent", uaString)
-	client := new(http.Client)
-	resp, err := client.Do(req)
+	if cache.IsGone(url) {
+		return ErrGone
+	}
+	data, err := RetrieveRemoteObject(url, uaString, key)
+	if err == ErrGone {
+		cache.MarkGone(url)
+	}
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return errors.New(resp.Status)
-	}
-
-	data, _ := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal(data, &actor)
 	if err != nil {
 		return err
 	}
-	cache.Set(url, data, 5*time.Minute)
+	cache.Set(url, data)
 	return nil
 }
 
@@ -99,11 +313,12 @@ func (actor *Actor) RetrieveRemoteActor(url string, uaString string, cache *cach
 type Activity struct {
 	Context interface{} `json:"@context,omitempty"`
 	ID      string      `json:"id,omitempty"`
-	Actor   string      `json:"actor,omitempty"`
+	Actor   Link        `json:"actor,omitempty"`
 	Type    string      `json:"type,omitempty"`
-	Object  interface{} `json:"object,omitempty"`
-	To      []string    `json:"to,omitempty"`
-	Cc      []string    `json:"cc,omitempty"`
+	Object  Objects     `json:"object,omitempty"`
+	To      Strings     `json:"to,omitempty"`
+	Cc      Strings     `json:"cc,omitempty"`
+	Target  Link        `json:"target,omitempty"`
 }
 
 // GenerateResponse : Generate activity response.
@@ -111,11 +326,12 @@ func (activity *Activity) GenerateResponse(host *url.URL, responseType string) A
 	return Activity{
 		[]string{"https://www.w3.org/ns/activitystreams"},
 		host.String() + "/activities/" + uuid.NewV4().String(),
-		host.String() + "/actor",
+		Link(host.String() + "/actor"),
 		responseType,
-		&activity,
+		Embed(activity),
 		nil,
 		nil,
+		"",
 	}
 }
 
@@ -124,53 +340,148 @@ func (activity *Activity) GenerateAnnounce(host *url.URL) Activity {
 	return Activity{
 		[]string{"https://www.w3.org/ns/activitystreams"},
 		host.String() + "/activities/" + uuid.NewV4().String(),
-		host.String() + "/actor",
+		Link(host.String() + "/actor"),
 		"Announce",
-		activity.ID,
+		LinkTo(activity.ID),
 		[]string{host.String() + "/actor/followers"},
 		nil,
+		"",
 	}
 }
 
-// NestedActivity : Unwrap nested activity.
-func (activity *Activity) NestedActivity() (*Activity, error) {
-	mappedObject := activity.Object.(map[string]interface{})
-	if id, ok := mappedObject["id"].(string); ok {
-		if nestedType, ok := mappedObject["type"].(string); ok {
-			actor, ok := mappedObject["actor"].(string)
-			if !ok {
-				actor = ""
-			}
-			switch object := mappedObject["object"].(type) {
-			case string:
-				return &Activity{
-					ID:     id,
-					Type:   nestedType,
-					Actor:  actor,
-					Object: object,
-				}, nil
-			default:
-				return &Activity{
-					ID:     id,
-					Type:   nestedType,
-					Actor:  actor,
-					Object: mappedObject["object"],
-				}, nil
-			}
+// GenerateUndo : Generate Undo of relay's own activity.
+func (activity *Activity) GenerateUndo(host *url.URL) Activity {
+	undone := *activity
+	undone.Context = nil
+	return Activity{
+		[]string{"https://www.w3.org/ns/activitystreams"},
+		host.String() + "/activities/" + uuid.NewV4().String(),
+		Link(host.String() + "/actor"),
+		"Undo",
+		Embed(&undone),
+		[]string{host.String() + "/actor/followers"},
+		nil,
+		"",
+	}
+}
+
+// ObjectID : ID of single object, empty if object is array of them, use ObjectIDs for array.
+func (activity *Activity) ObjectID() string {
+	if len(activity.Object) != 1 {
+		return ""
+	}
+	return activity.Object[0].ID
+}
+
+// ObjectIDs : IDs of objects, object may be given as ID, embedded or array of them.
+func (activity *Activity) ObjectIDs() []string {
+	var ids []string
+	for _, object := range activity.Object {
+		if object.ID != "" {
+			ids = append(ids, object.ID)
 		}
+	}
+	return ids
+}
+
+// ObjectTypes : Types of embedded objects, object given as ID has no type.
+func (activity *Activity) ObjectTypes() []string {
+	var types []string
+	for _, object := range activity.Object {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		if object.Decode(&typed) == nil && typed.Type != "" {
+			types = append(types, typed.Type)
+		}
+	}
+	return types
+}
+
+// NestedActivity : Unwrap nested activity, single embedded object with id and type is required.
+func (activity *Activity) NestedActivity() (*Activity, error) {
+	if len(activity.Object) != 1 {
+		return nil, errors.New("Object is not single")
+	}
+	var nestedActivity Activity
+	err := activity.Object[0].Decode(&nestedActivity)
+	if err != nil {
+		return nil, err
+	}
+	if nestedActivity.ID == "" {
+		return nil, errors.New("Can't assart id")
+	}
+	if nestedActivity.Type == "" {
 		return nil, errors.New("Can't assart type")
 	}
-	return nil, errors.New("Can't assart id")
+	nestedActivity.Context = nil
+	return &nestedActivity, nil
 }
 
 // ActivityObject : ActivityPub Activity.
 type ActivityObject struct {
-	ID      string   `json:"id,omitempty"`
-	Type    string   `json:"type,omitempty"`
-	Name    string   `json:"name,omitempty"`
-	Content string   `json:"content,omitempty"`
-	To      []string `json:"to,omitempty"`
-	Cc      []string `json:"cc,omitempty"`
+	ID           string  `json:"id,omitempty"`
+	Type         string  `json:"type,omitempty"`
+	Name         string  `json:"name,omitempty"`
+	AttributedTo Link    `json:"attributedTo,omitempty"`
+	Published    string  `json:"published,omitempty"`
+	Content      string  `json:"content,omitempty"`
+	To           Strings `json:"to,omitempty"`
+	Cc           Strings `json:"cc,omitempty"`
+	Tag          []Tag   `json:"tag,omitempty"`
+}
+
+// Tag : ActivityPub Tag (Mention, Hashtag).
+type Tag struct {
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// OrderedCollection : ActivityPub OrderedCollection and OrderedCollectionPage.
+type OrderedCollection struct {
+	Context      interface{}   `json:"@context,omitempty"`
+	ID           string        `json:"id,omitempty"`
+	Type         string        `json:"type,omitempty"`
+	TotalItems   int           `json:"totalItems"`
+	First        string        `json:"first,omitempty"`
+	PartOf       string        `json:"partOf,omitempty"`
+	Next         string        `json:"next,omitempty"`
+	Prev         string        `json:"prev,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+// GenerateOrderedCollection : Generate OrderedCollection, link to first page if paged.
+func GenerateOrderedCollection(id string, totalItems int, paged bool) OrderedCollection {
+	collection := OrderedCollection{
+		Context:    "https://www.w3.org/ns/activitystreams",
+		ID:         id,
+		Type:       "OrderedCollection",
+		TotalItems: totalItems,
+	}
+	if paged && totalItems > 0 {
+		collection.First = id + "?page=1"
+	}
+	return collection
+}
+
+// GenerateOrderedCollectionPage : Generate OrderedCollectionPage from items of page, page starts from 1.
+func GenerateOrderedCollectionPage(id string, items []interface{}, totalItems int, page int, pageSize int) OrderedCollection {
+	collection := OrderedCollection{
+		Context:      "https://www.w3.org/ns/activitystreams",
+		ID:           id + "?page=" + strconv.Itoa(page),
+		Type:         "OrderedCollectionPage",
+		TotalItems:   totalItems,
+		PartOf:       id,
+		OrderedItems: items,
+	}
+	if page*pageSize < totalItems {
+		collection.Next = id + "?page=" + strconv.Itoa(page+1)
+	}
+	if page > 1 {
+		collection.Prev = id + "?page=" + strconv.Itoa(page-1)
+	}
+	return collection
 }
 
 // Signature : ActivityPub Header Signature.
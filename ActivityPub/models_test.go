@@ -0,0 +1,149 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestActivityRoundTrip(t *testing.T) {
+	for _, fixture := range []string{"announce", "create", "follow", "followAsActor", "undo", "unfollow"} {
+		data, err := ioutil.ReadFile("../misc/" + fixture + ".json")
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		var activity Activity
+		err = json.Unmarshal(data, &activity)
+		if err != nil {
+			t.Fatalf("Failed - " + fixture + " : " + err.Error())
+		}
+		var raw map[string]interface{}
+		json.Unmarshal(data, &raw)
+		if activity.ID != raw["id"] || activity.Type != raw["type"] || string(activity.Actor) != raw["actor"] {
+			t.Fatalf("Failed - " + fixture + " : Property not decoded.")
+		}
+
+		encoded, _ := json.Marshal(&activity)
+		var decoded Activity
+		err = json.Unmarshal(encoded, &decoded)
+		if err != nil || !reflect.DeepEqual(activity, decoded) {
+			t.Fatalf("Failed - " + fixture + " : Round trip changed activity.")
+		}
+	}
+}
+
+func TestActorRoundTrip(t *testing.T) {
+	for _, fixture := range []string{"person", "service", "application"} {
+		data, err := ioutil.ReadFile("../misc/" + fixture + ".json")
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		var actor Actor
+		err = json.Unmarshal(data, &actor)
+		if err != nil || actor.ID == "" || actor.Inbox == "" || actor.PublicKey.PublicKeyPem == "" {
+			t.Fatalf("Failed - " + fixture + " : Actor not decoded.")
+		}
+
+		encoded, _ := json.Marshal(&actor)
+		var decoded Actor
+		err = json.Unmarshal(encoded, &decoded)
+		if err != nil || !reflect.DeepEqual(actor, decoded) {
+			t.Fatalf("Failed - " + fixture + " : Round trip changed actor.")
+		}
+	}
+}
+
+func TestActivityLenientProperties(t *testing.T) {
+	data := []byte(`{
+		"@context": {"@vocab": "https://www.w3.org/ns/activitystreams"},
+		"id": "https://example.com/activities/1",
+		"type": "Delete",
+		"actor": {"id": "https://example.com/users/example", "type": "Person"},
+		"object": ["https://example.com/notes/1", "https://example.com/notes/2"],
+		"to": "https://www.w3.org/ns/activitystreams#Public",
+		"cc": [{"type": "Link", "href": "https://example.com/users/example/followers"}]
+	}`)
+	var activity Activity
+	err := json.Unmarshal(data, &activity)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if activity.Actor != "https://example.com/users/example" {
+		t.Fatalf("Failed - Embedded actor not reduced to ID.")
+	}
+	if !reflect.DeepEqual(activity.To, Strings{"https://www.w3.org/ns/activitystreams#Public"}) || !reflect.DeepEqual(activity.Cc, Strings{"https://example.com/users/example/followers"}) {
+		t.Fatalf("Failed - Single value or Link object not accepted.")
+	}
+	if activity.ObjectID() != "" || !reflect.DeepEqual(activity.ObjectIDs(), []string{"https://example.com/notes/1", "https://example.com/notes/2"}) {
+		t.Fatalf("Failed - Array object not decoded.")
+	}
+	if _, err := activity.NestedActivity(); err == nil {
+		t.Fatalf("Failed - Array object unwrapped.")
+	}
+}
+
+func TestObjectsRoundTrip(t *testing.T) {
+	for _, data := range []string{
+		`"https://example.com/notes/1"`,
+		`{"id":"https://example.com/notes/1","type":"Note","content":"\u003cp\u003eHello\u003c/p\u003e"}`,
+		`{"type":"Link","href":"https://example.com/notes/1"}`,
+		`["https://example.com/notes/1",{"id":"https://example.com/notes/2","type":"Note"}]`,
+	} {
+		var objects Objects
+		err := json.Unmarshal([]byte(data), &objects)
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		if len(objects) == 0 || objects[0].ID != "https://example.com/notes/1" {
+			t.Fatalf("Failed - " + data + " : ID not decoded.")
+		}
+		encoded, err := json.Marshal(objects)
+		if err != nil || string(encoded) != data {
+			t.Fatalf("Failed - " + data + " : Round trip changed object - " + string(encoded))
+		}
+	}
+
+	var objects Objects
+	json.Unmarshal([]byte(`[null, 1, "https://example.com/notes/1"]`), &objects)
+	if !reflect.DeepEqual(objects, LinkTo("https://example.com/notes/1")) {
+		t.Fatalf("Failed - Invalid object not skipped.")
+	}
+
+	objects = Embed(ActivityObject{ID: "https://example.com/notes/1", Type: "Note"})
+	var note ActivityObject
+	if len(objects) != 1 || objects[0].ID != "https://example.com/notes/1" || objects[0].Decode(&note) != nil || note.Type != "Note" {
+		t.Fatalf("Failed - Embedded object not decoded.")
+	}
+	if LinkTo("https://example.com/notes/1")[0].Decode(&note) == nil {
+		t.Fatalf("Failed - Object given as ID decoded.")
+	}
+}
+
+func TestNestedActivity(t *testing.T) {
+	activity := Activity{Type: "Undo", Object: LinkTo("https://example.com/activities/1")}
+	_, err := activity.NestedActivity()
+	if err == nil {
+		t.Fatalf("Failed - Object given as ID unwrapped.")
+	}
+
+	activity.Object = Embed(map[string]interface{}{"type": "Follow"})
+	_, err = activity.NestedActivity()
+	if err == nil {
+		t.Fatalf("Failed - Object without ID unwrapped.")
+	}
+
+	activity.Object = Embed(map[string]interface{}{
+		"id":     "https://example.com/activities/1",
+		"type":   "Follow",
+		"actor":  map[string]interface{}{"id": "https://example.com/users/example"},
+		"object": "https://www.w3.org/ns/activitystreams#Public",
+	})
+	nestedActivity, err := activity.NestedActivity()
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if nestedActivity.Type != "Follow" || nestedActivity.Actor != "https://example.com/users/example" || nestedActivity.ObjectID() != "https://www.w3.org/ns/activitystreams#Public" {
+		t.Fatalf("Failed - Nested activity not unwrapped.")
+	}
+}
@@ -0,0 +1,226 @@
+package nodeinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Supported nodeinfo schemas, preferred first
+var supportedSchemas = []string{
+	"http://nodeinfo.diaspora.software/ns/schema/2.1",
+	"http://nodeinfo.diaspora.software/ns/schema/2.0",
+}
+
+const maxDocumentSize = 1 << 20
+
+var (
+	// ErrNoSupportedSchema : Well-known document has no link for supported schema
+	ErrNoSupportedSchema = errors.New("nodeinfo: no supported schema")
+	// ErrInvalidDocument : Document is not valid JSON
+	ErrInvalidDocument = errors.New("nodeinfo: invalid document")
+	// ErrNoUsers : Document has no user count
+	ErrNoUsers = errors.New("nodeinfo: user count is not provided")
+)
+
+// StatusError : Remote server responded non-200 status
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("nodeinfo: %s responded %d", err.URL, err.StatusCode)
+}
+
+// Info : Instance information from nodeinfo
+type Info struct {
+	Schema              string `json:"schema"`
+	Software            string `json:"software"`
+	Version             string `json:"version"`
+	OpenRegistrations   bool   `json:"openRegistrations"`
+	TotalUsers          *int   `json:"totalUsers,omitempty"`
+	ActiveMonthUsers    *int   `json:"activeMonthUsers,omitempty"`
+	ActiveHalfyearUsers *int   `json:"activeHalfyearUsers,omitempty"`
+	LocalPosts          *int   `json:"localPosts,omitempty"`
+	// FetchedAt : Time of fetch from remote, cached result keeps it
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// Users : Total users or monthly active users
+func (info *Info) Users(byTotal bool) (int, error) {
+	users := info.ActiveMonthUsers
+	if byTotal {
+		users = info.TotalUsers
+	}
+	if users == nil {
+		return 0, ErrNoUsers
+	}
+	return *users, nil
+}
+
+// Posts : Number of local posts, -1 if not provided
+func (info *Info) Posts() int {
+	if info.LocalPosts == nil {
+		return -1
+	}
+	return *info.LocalPosts
+}
+
+type links struct {
+	Links []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+type document struct {
+	Software struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"software"`
+	OpenRegistrations bool `json:"openRegistrations"`
+	Usage             struct {
+		Users struct {
+			Total          *int `json:"total"`
+			ActiveMonth    *int `json:"activeMonth"`
+			ActiveHalfyear *int `json:"activeHalfyear"`
+		} `json:"users"`
+		LocalPosts *int `json:"localPosts"`
+	} `json:"usage"`
+}
+
+// Client : Nodeinfo client with cache
+type Client struct {
+	HTTPClient  *http.Client
+	RedisClient *redis.Client
+	UserAgent   string
+	CacheTTL    time.Duration
+}
+
+// NewClient : Create new Client, nil redisClient disables cache
+func NewClient(redisClient *redis.Client, uaString string, cacheTTL time.Duration) *Client {
+	return &Client{
+		HTTPClient:  &http.Client{Timeout: time.Duration(10) * time.Second},
+		RedisClient: redisClient,
+		UserAgent:   uaString,
+		CacheTTL:    cacheTTL,
+	}
+}
+
+// Fetch : Retrieve nodeinfo of domain, cached result is used if available
+func (client *Client) Fetch(domain string) (*Info, error) {
+	if client.RedisClient != nil {
+		cacheData, err := client.RedisClient.Get("relay:nodeinfo:" + domain).Bytes()
+		if err == nil {
+			var info Info
+			if json.Unmarshal(cacheData, &info) == nil {
+				return &info, nil
+			}
+		}
+	}
+
+	info, err := client.fetch(domain)
+	if err != nil {
+		return nil, err
+	}
+	if client.RedisClient != nil && client.CacheTTL > 0 {
+		cacheData, _ := json.Marshal(info)
+		client.RedisClient.Set("relay:nodeinfo:"+domain, cacheData, client.CacheTTL)
+	}
+	return info, nil
+}
+
+// Purge : Remove cached nodeinfo of domain
+func (client *Client) Purge(domain string) {
+	if client.RedisClient != nil {
+		client.RedisClient.Del("relay:nodeinfo:" + domain)
+	}
+}
+
+func (client *Client) fetch(domain string) (*Info, error) {
+	wellKnown, err := url.Parse("https://" + domain + "/.well-known/nodeinfo")
+	if err != nil {
+		return nil, err
+	}
+	var nodeinfoLinks links
+	err = client.get(wellKnown.String(), &nodeinfoLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema, href string
+	for _, supported := range supportedSchemas {
+		for _, link := range nodeinfoLinks.Links {
+			if link.Rel == supported {
+				schema = supported
+				href = link.Href
+				break
+			}
+		}
+		if href != "" {
+			break
+		}
+	}
+	if href == "" {
+		return nil, ErrNoSupportedSchema
+	}
+	documentURL, err := wellKnown.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	if documentURL.Scheme != "https" && documentURL.Scheme != "http" {
+		return nil, ErrNoSupportedSchema
+	}
+
+	var doc document
+	err = client.get(documentURL.String(), &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		Schema:              schema,
+		Software:            doc.Software.Name,
+		Version:             doc.Software.Version,
+		OpenRegistrations:   doc.OpenRegistrations,
+		TotalUsers:          doc.Usage.Users.Total,
+		ActiveMonthUsers:    doc.Usage.Users.ActiveMonth,
+		ActiveHalfyearUsers: doc.Usage.Users.ActiveHalfyear,
+		LocalPosts:          doc.Usage.LocalPosts,
+		FetchedAt:           time.Now(),
+	}, nil
+}
+
+func (client *Client) get(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", client.UserAgent)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &StatusError{url, resp.StatusCode}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return ErrInvalidDocument
+	}
+	return nil
+}
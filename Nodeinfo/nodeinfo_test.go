@@ -0,0 +1,168 @@
+package nodeinfo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+)
+
+var redisClient *redis.Client
+
+func TestMain(m *testing.M) {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		fmt.Println("Config file is not exists. Use environment variables.")
+		viper.BindEnv("redis_url")
+	}
+	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
+	if err != nil {
+		panic(err)
+	}
+	redisClient = redis.NewClient(redisOption)
+
+	code := m.Run()
+	os.Exit(code)
+	redisClient.FlushAll().Result()
+}
+
+func mockNodeinfoServer(wellKnown string, document string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/nodeinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(wellKnown))
+	})
+	mux.HandleFunc("/nodeinfo/2.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"2.0","software":{"name":"old"},"usage":{"users":{}}}`))
+	})
+	mux.HandleFunc("/nodeinfo/2.1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(document))
+	})
+	return httptest.NewTLSServer(mux)
+}
+
+func testClient(s *httptest.Server, redisClient *redis.Client) (*Client, string) {
+	client := NewClient(redisClient, "test", time.Minute)
+	client.HTTPClient = s.Client()
+	host, _ := url.Parse(s.URL)
+	return client, host.Host
+}
+
+func TestFetchSelectSchema(t *testing.T) {
+	s := mockNodeinfoServer(
+		`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"/nodeinfo/2.0"},{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"/nodeinfo/2.1"}]}`,
+		`{"version":"2.1","software":{"name":"mastodon","version":"3.1.3"},"openRegistrations":true,"usage":{"users":{"total":120,"activeMonth":40},"localPosts":5000}}`,
+	)
+	defer s.Close()
+	client, domain := testClient(s, nil)
+
+	info, err := client.Fetch(domain)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if info.Software != "mastodon" || info.Version != "3.1.3" || !info.OpenRegistrations || info.Posts() != 5000 {
+		t.Fatalf("Failed - Nodeinfo 2.1 not selected.")
+	}
+	total, _ := info.Users(true)
+	active, _ := info.Users(false)
+	if total != 120 || active != 40 {
+		t.Fatalf("Failed - User count is invalid.")
+	}
+}
+
+func TestFetchNoUsers(t *testing.T) {
+	s := mockNodeinfoServer(
+		`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"/nodeinfo/2.1"}]}`,
+		`{"version":"2.1","software":{"name":"misskey"}}`,
+	)
+	defer s.Close()
+	client, domain := testClient(s, nil)
+
+	info, err := client.Fetch(domain)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	_, err = info.Users(true)
+	if err != ErrNoUsers {
+		t.Fatalf("Failed - Missing user count not reported.")
+	}
+	if info.Posts() != -1 {
+		t.Fatalf("Failed - Missing post count not reported.")
+	}
+}
+
+func TestFetchNoSupportedSchema(t *testing.T) {
+	s := mockNodeinfoServer(
+		`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/1.0","href":"/nodeinfo/1.0"}]}`,
+		``,
+	)
+	defer s.Close()
+	client, domain := testClient(s, nil)
+
+	_, err := client.Fetch(domain)
+	if err != ErrNoSupportedSchema {
+		t.Fatalf("Failed - Unsupported schema not reported.")
+	}
+}
+
+func TestFetchInvalidDocument(t *testing.T) {
+	s := mockNodeinfoServer(
+		`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"/nodeinfo/2.1"}]}`,
+		`<html></html>`,
+	)
+	defer s.Close()
+	client, domain := testClient(s, nil)
+
+	_, err := client.Fetch(domain)
+	if err != ErrInvalidDocument {
+		t.Fatalf("Failed - Invalid document not reported.")
+	}
+}
+
+func TestFetchNotFound(t *testing.T) {
+	s := httptest.NewTLSServer(http.NotFoundHandler())
+	defer s.Close()
+	client, domain := testClient(s, nil)
+
+	_, err := client.Fetch(domain)
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.StatusCode != 404 {
+		t.Fatalf("Failed - Status not reported.")
+	}
+}
+
+func TestFetchCached(t *testing.T) {
+	redisClient.FlushAll().Result()
+	s := mockNodeinfoServer(
+		`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"/nodeinfo/2.1"}]}`,
+		`{"version":"2.1","software":{"name":"pleroma","version":"2.0.0"},"usage":{"users":{"total":3}}}`,
+	)
+	client, domain := testClient(s, redisClient)
+
+	_, err := client.Fetch(domain)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	s.Close()
+
+	info, err := client.Fetch(domain)
+	if err != nil {
+		t.Fatalf("Failed - Cache not used.")
+	}
+	if info.Software != "pleroma" {
+		t.Fatalf("Failed - Cached nodeinfo is invalid.")
+	}
+
+	client.Purge(domain)
+	_, err = client.Fetch(domain)
+	if err == nil {
+		t.Fatalf("Failed - Cache not purged.")
+	}
+	redisClient.FlushAll().Result()
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Blocklist : Domains collected from blocklist feeds
+type Blocklist struct {
+	mutex   sync.RWMutex
+	domains map[string]bool
+}
+
+// NewBlocklist : Create empty Blocklist
+func NewBlocklist() *Blocklist {
+	return &Blocklist{domains: map[string]bool{}}
+}
+
+// Contains : Check domain or its parent domain is listed
+func (blocklist *Blocklist) Contains(domain string) bool {
+	blocklist.mutex.RLock()
+	defer blocklist.mutex.RUnlock()
+	domain = strings.ToLower(domain)
+	for {
+		if blocklist.domains[domain] {
+			return true
+		}
+		index := strings.Index(domain, ".")
+		if index < 0 {
+			return false
+		}
+		domain = domain[index+1:]
+	}
+}
+
+// Len : Number of listed domains
+func (blocklist *Blocklist) Len() int {
+	blocklist.mutex.RLock()
+	defer blocklist.mutex.RUnlock()
+	return len(blocklist.domains)
+}
+
+// Refresh : Replace listed domains by fetching all feeds.
+// Previous list is kept when any feed is unavailable.
+func (blocklist *Blocklist) Refresh(client *http.Client, feeds []string, uaString string) error {
+	domains := map[string]bool{}
+	for _, feed := range feeds {
+		req, err := http.NewRequest("GET", feed, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", uaString)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return errors.New("Get " + feed + ": " + resp.Status)
+		}
+		err = parseFeed(resp.Body, domains)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	blocklist.mutex.Lock()
+	blocklist.domains = domains
+	blocklist.mutex.Unlock()
+	return nil
+}
+
+// parseFeed : Read plain text or CSV (Mastodon domain block export) feed.
+// First column of each line is domain, lines start with "#" are ignored.
+func parseFeed(reader io.Reader, domains map[string]bool) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain := strings.TrimSpace(strings.SplitN(line, ",", 2)[0])
+		if domain == "" {
+			continue
+		}
+		domains[strings.ToLower(domain)] = true
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"strconv"
+	"time"
+)
+
+// Grace : Grace before subscriber is kicked, zero value kicks at first violation
+type Grace struct {
+	Checks int
+	Period time.Duration
+}
+
+// Violation : Continuous violation of domain
+type Violation struct {
+	Count     int
+	FirstAt   time.Time
+	Reason    string
+	Warned    bool
+	CheckedAt time.Time // Fetch time of nodeinfo last counted, zero if not known
+}
+
+// Expired : Check grace is over for violation
+func (grace *Grace) Expired(violation Violation, now time.Time) bool {
+	if grace.Checks <= 0 && grace.Period <= 0 {
+		return true
+	}
+	if grace.Checks > 0 && violation.Count >= grace.Checks {
+		return true
+	}
+	if grace.Period > 0 && now.Sub(violation.FirstAt) >= grace.Period {
+		return true
+	}
+	return false
+}
+
+// Until : Remaining checks and end of period before grace expires, zero means not limited by it
+func (grace *Grace) Until(violation Violation) (int, time.Time) {
+	var checks int
+	var until time.Time
+	if grace.Checks > 0 {
+		checks = grace.Checks - violation.Count
+	}
+	if grace.Period > 0 {
+		until = violation.FirstAt.Add(grace.Period)
+	}
+	return checks, until
+}
+
+// Counted : Check violation on nodeinfo fetched at checkedAt is already counted
+func (violation Violation) Counted(checkedAt time.Time) bool {
+	return !checkedAt.IsZero() && !violation.CheckedAt.IsZero() && !checkedAt.After(violation.CheckedAt)
+}
+
+// Next : Violation after one more check at now on nodeinfo fetched at checkedAt, RecordViolation records same
+func (violation Violation) Next(now time.Time, checkedAt time.Time) Violation {
+	if violation.Counted(checkedAt) {
+		return violation
+	}
+	if !checkedAt.IsZero() {
+		violation.CheckedAt = checkedAt
+	}
+	if violation.Count == 0 {
+		violation.FirstAt = now
+	}
+	violation.Count++
+	return violation
+}
+
+// RecordViolation : Count up violation of domain, violation on nodeinfo checked at same time is counted once
+func (inspector *Inspector) RecordViolation(domain string, reason string, checkedAt time.Time) (Violation, error) {
+	key := "relay:spy:violation:" + domain
+	violation, err := inspector.Violation(domain)
+	if err != nil {
+		return Violation{}, err
+	}
+	// Cached nodeinfo is reviewed repeatedly until expired
+	if violation.Counted(checkedAt) {
+		return violation, nil
+	}
+	pipe := inspector.RedisClient.TxPipeline()
+	pipe.HIncrBy(key, "count", 1)
+	pipe.HSetNX(key, "first_at", time.Now().Unix())
+	pipe.HSet(key, "reason", reason)
+	if !checkedAt.IsZero() {
+		pipe.HSet(key, "checked_at", checkedAt.UnixNano())
+	}
+	_, err = pipe.Exec()
+	if err != nil {
+		return Violation{}, err
+	}
+	return inspector.Violation(domain)
+}
+
+// Violation : Get violation of domain, zero Count means no violation
+func (inspector *Inspector) Violation(domain string) (Violation, error) {
+	data, err := inspector.RedisClient.HGetAll("relay:spy:violation:" + domain).Result()
+	if err != nil {
+		return Violation{}, err
+	}
+	count, _ := strconv.Atoi(data["count"])
+	firstAt, _ := strconv.ParseInt(data["first_at"], 10, 64)
+	violation := Violation{
+		Count:   count,
+		FirstAt: time.Unix(firstAt, 0),
+		Reason:  data["reason"],
+		Warned:  data["warned"] != "",
+	}
+	if checkedAt, _ := strconv.ParseInt(data["checked_at"], 10, 64); checkedAt != 0 {
+		violation.CheckedAt = time.Unix(0, checkedAt)
+	}
+	return violation, nil
+}
+
+// MarkWarned : Record warning is sent for violation, return false if already warned
+func (inspector *Inspector) MarkWarned(domain string) bool {
+	warned, _ := inspector.RedisClient.HSetNX("relay:spy:violation:"+domain, "warned", time.Now().Unix()).Result()
+	return warned
+}
+
+// ClearViolation : Forget violation of domain
+func (inspector *Inspector) ClearViolation(domain string) {
+	inspector.RedisClient.Del("relay:spy:violation:" + domain)
+}
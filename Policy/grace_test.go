@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+	nodeinfo "github.com/yukimochi/Activity-Relay/Nodeinfo"
+)
+
+var redisClient *redis.Client
+
+func TestMain(m *testing.M) {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		fmt.Println("Config file is not exists. Use environment variables.")
+		viper.BindEnv("redis_url")
+	}
+	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
+	if err != nil {
+		panic(err)
+	}
+	redisClient = redis.NewClient(redisOption)
+
+	code := m.Run()
+	os.Exit(code)
+	redisClient.FlushAll().Result()
+}
+
+func TestRecordViolationCachedNodeinfo(t *testing.T) {
+	redisClient.FlushAll().Result()
+	inspector := &Inspector{
+		RedisClient: redisClient,
+		Nodeinfo:    nodeinfo.NewClient(redisClient, "test", time.Hour),
+	}
+	grace := Grace{Checks: 3}
+	users := 100000
+	cached, _ := json.Marshal(&nodeinfo.Info{Software: "mastodon", TotalUsers: &users, FetchedAt: time.Now()})
+	redisClient.Set("relay:nodeinfo:glitch.example.jp", cached, time.Hour)
+
+	var violation Violation
+	for i := 0; i < 5; i++ {
+		subject, err := inspector.Subject("glitch.example.jp", 1)
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		violation, err = inspector.RecordViolation(subject.Domain, "User count is 100000", subject.CheckedAt)
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+	}
+	if violation.Count != 1 || grace.Expired(violation, time.Now()) {
+		t.Fatalf("Failed - Cached nodeinfo counted as %d checks.", violation.Count)
+	}
+
+	cached, _ = json.Marshal(&nodeinfo.Info{Software: "mastodon", TotalUsers: &users, FetchedAt: time.Now().Add(time.Minute)})
+	redisClient.Set("relay:nodeinfo:glitch.example.jp", cached, time.Hour)
+	subject, _ := inspector.Subject("glitch.example.jp", 1)
+	violation, _ = inspector.RecordViolation(subject.Domain, "User count is 100000", subject.CheckedAt)
+	if violation.Count != 2 {
+		t.Fatalf("Failed - Refetched nodeinfo not counted.")
+	}
+
+	redisClient.FlushAll().Result()
+}
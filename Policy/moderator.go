@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-redis/redis"
+	nodeinfo "github.com/yukimochi/Activity-Relay/Nodeinfo"
+)
+
+// Settings : Legacy spy settings in config.yaml, zero value disables each limit
+type Settings struct {
+	AllowMaxUser  int
+	AllowMinUser  int
+	KickMaxUser   int
+	KickMinUser   int
+	MaxInstances  int
+	WhitelistMode bool
+	BlacklistMode bool
+	Whitelist     []string
+	Blacklist     []string
+}
+
+// DomainPermitted : Check domain by whitelist or blacklist
+func (settings *Settings) DomainPermitted(domain string) bool {
+	if settings.WhitelistMode {
+		for _, rep := range settings.Whitelist {
+			should, err := regexp.MatchString(rep, domain)
+			if err != nil {
+				continue
+			}
+			if should {
+				return true
+			}
+		}
+		return false
+	}
+	if settings.BlacklistMode {
+		for _, rep := range settings.Blacklist {
+			should, err := regexp.MatchString(rep, domain)
+			if err != nil {
+				continue
+			}
+			if should {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Permit : Decide follow-request by settings
+func (settings *Settings) Permit(subject Subject) Decision {
+	if settings.MaxInstances != 0 && subject.Subscribers > settings.MaxInstances {
+		return Decision{Reject, "max_instances", "Existing instances is too much"}
+	}
+	if !settings.DomainPermitted(subject.Domain) {
+		return Decision{Reject, "whitelist/blacklist", "Blacklist/whitelist policy"}
+	}
+	// Domain without valid nodeinfo is not accepted even if user count is not limited
+	if !subject.HasNodeinfo || subject.Users < 0 {
+		return Decision{Hold, "allow_user", "User count is unknown"}
+	}
+	if settings.AllowMaxUser == 0 {
+		return Decision{Accept, "default", "No user count limit"}
+	}
+	if subject.Users > settings.AllowMinUser && subject.Users < settings.AllowMaxUser {
+		return Decision{Accept, "allow_user", fmt.Sprintf("User count is %d", subject.Users)}
+	}
+	return Decision{Reject, "allow_user", fmt.Sprintf("User count is %d", subject.Users)}
+}
+
+// Review : Decide subscriber by settings, Reject means subscriber should be kicked
+func (settings *Settings) Review(subject Subject) Decision {
+	if !settings.DomainPermitted(subject.Domain) {
+		return Decision{Reject, "whitelist/blacklist", "Blacklist/whitelist policy"}
+	}
+	if settings.KickMaxUser == 0 && settings.KickMinUser == 0 {
+		return Decision{Accept, "default", "No user count limit"}
+	}
+	if subject.Users < 0 {
+		return Decision{Hold, "kick_user", "User count is unknown"}
+	}
+	if (settings.KickMaxUser != 0 && subject.Users > settings.KickMaxUser) || (settings.KickMinUser != 0 && subject.Users < settings.KickMinUser) {
+		return Decision{Reject, "kick_user", fmt.Sprintf("User count is %d", subject.Users)}
+	}
+	return Decision{Accept, "kick_user", fmt.Sprintf("User count is %d", subject.Users)}
+}
+
+// Moderator : Decide follow-request by policy file if given, otherwise by settings
+type Moderator struct {
+	Settings Settings
+	Policy   *Policy
+}
+
+// Permit : Decide follow-request
+func (moderator *Moderator) Permit(subject Subject) Decision {
+	if moderator.Policy != nil {
+		return moderator.Policy.Evaluate(subject)
+	}
+	return moderator.Settings.Permit(subject)
+}
+
+// Review : Decide subscriber, Reject means subscriber should be kicked
+func (moderator *Moderator) Review(subject Subject) Decision {
+	return moderator.Settings.Review(subject)
+}
+
+// Inspector : Collect Subject of domain
+type Inspector struct {
+	RedisClient *redis.Client
+	Nodeinfo    *nodeinfo.Client
+	Blocklist   *Blocklist
+	ByTotal     bool
+}
+
+// MarkSeen : Record first seen time of domain
+func (inspector *Inspector) MarkSeen(domain string) {
+	inspector.RedisClient.HSetNX("relay:spy:firstSeen", domain, time.Now().Unix())
+}
+
+// Subject : Collect Subject of domain, error is returned with partial Subject if nodeinfo is unavailable
+func (inspector *Inspector) Subject(domain string, subscribers int) (Subject, error) {
+	subject := Subject{
+		Domain:      domain,
+		Users:       -1,
+		Posts:       -1,
+		Subscribers: subscribers,
+		FirstSeen:   time.Now(),
+	}
+	unix, err := inspector.RedisClient.HGet("relay:spy:firstSeen", domain).Int64()
+	if err == nil {
+		subject.FirstSeen = time.Unix(unix, 0)
+	}
+	if inspector.Blocklist != nil {
+		subject.InBlocklist = inspector.Blocklist.Contains(domain)
+	}
+
+	info, err := inspector.Nodeinfo.Fetch(domain)
+	if err != nil {
+		return subject, err
+	}
+	subject.HasNodeinfo = true
+	subject.CheckedAt = info.FetchedAt
+	subject.Software = info.Software
+	subject.Version = info.Version
+	subject.OpenRegistrations = info.OpenRegistrations
+	subject.Posts = info.Posts()
+	users, err := info.Users(inspector.ByTotal)
+	if err == nil {
+		subject.Users = users
+	}
+	return subject, nil
+}
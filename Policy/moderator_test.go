@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsPermit(t *testing.T) {
+	settings := Settings{
+		AllowMaxUser:  100,
+		AllowMinUser:  1,
+		MaxInstances:  30,
+		BlacklistMode: true,
+		Blacklist:     []string{"\\.spam\\.example$"},
+	}
+	subjects := []struct {
+		subject Subject
+		action  Action
+	}{
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: 10, Subscribers: 10}, Accept},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: 100, Subscribers: 10}, Reject},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: -1, Subscribers: 10}, Hold},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: 10, Subscribers: 31}, Reject},
+		{Subject{Domain: "b.spam.example", HasNodeinfo: true, Users: 10, Subscribers: 10}, Reject},
+	}
+	for _, s := range subjects {
+		decision := settings.Permit(s.subject)
+		if decision.Action != s.action {
+			t.Fatalf("Failed - %+v permitted as %+v", s.subject, decision)
+		}
+	}
+}
+
+func TestSettingsPermitNoUserLimit(t *testing.T) {
+	settings := Settings{}
+	subjects := []struct {
+		subject Subject
+		action  Action
+	}{
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: 10}, Accept},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Users: -1}, Hold},
+		{Subject{Domain: "a.example.jp", Users: -1}, Hold},
+	}
+	for _, s := range subjects {
+		decision := settings.Permit(s.subject)
+		if decision.Action != s.action {
+			t.Fatalf("Failed - %+v permitted as %+v", s.subject, decision)
+		}
+	}
+}
+
+func TestSettingsReview(t *testing.T) {
+	settings := Settings{
+		KickMaxUser:   200,
+		WhitelistMode: true,
+		Whitelist:     []string{"\\.example\\.jp$"},
+	}
+	subjects := []struct {
+		subject Subject
+		action  Action
+	}{
+		{Subject{Domain: "a.example.jp", Users: 10}, Accept},
+		{Subject{Domain: "a.example.jp", Users: 201}, Reject},
+		{Subject{Domain: "a.example.jp", Users: -1}, Hold},
+		{Subject{Domain: "a.example.com", Users: 10}, Reject},
+	}
+	for _, s := range subjects {
+		decision := settings.Review(s.subject)
+		if decision.Action != s.action {
+			t.Fatalf("Failed - %+v reviewed as %+v", s.subject, decision)
+		}
+	}
+}
+
+func TestGraceExpired(t *testing.T) {
+	now := time.Now()
+	graces := []struct {
+		grace     Grace
+		violation Violation
+		expired   bool
+	}{
+		{Grace{}, Violation{Count: 1, FirstAt: now}, true},
+		{Grace{Checks: 3}, Violation{Count: 2, FirstAt: now.Add(-time.Hour)}, false},
+		{Grace{Checks: 3}, Violation{Count: 3, FirstAt: now}, true},
+		{Grace{Period: time.Hour}, Violation{Count: 10, FirstAt: now.Add(-time.Minute)}, false},
+		{Grace{Period: time.Hour}, Violation{Count: 1, FirstAt: now.Add(-time.Hour)}, true},
+		{Grace{Checks: 3, Period: time.Hour}, Violation{Count: 1, FirstAt: now.Add(-2 * time.Hour)}, true},
+	}
+	for _, g := range graces {
+		if g.grace.Expired(g.violation, now) != g.expired {
+			t.Fatalf("Failed - %+v expired with %+v", g.grace, g.violation)
+		}
+	}
+}
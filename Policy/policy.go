@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Action : Result of policy evaluation
+type Action string
+
+const (
+	// Accept : Accept follow-request
+	Accept Action = "accept"
+	// Reject : Reject follow-request
+	Reject Action = "reject"
+	// Hold : Leave follow-request for human moderator
+	Hold Action = "hold"
+)
+
+// Duration : time.Duration which can be written as "72h" in YAML
+type Duration time.Duration
+
+// UnmarshalYAML : Parse duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	err := unmarshal(&str)
+	if err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Subject : Information about requesting domain
+type Subject struct {
+	Domain            string
+	HasNodeinfo       bool
+	Software          string
+	Version           string
+	OpenRegistrations bool
+	Users             int // -1 if unknown
+	Posts             int // -1 if unknown
+	Subscribers       int
+	FirstSeen         time.Time
+	InBlocklist       bool
+	CheckedAt         time.Time // Fetch time of nodeinfo, zero if unavailable
+}
+
+// Decision : Evaluated action with its reason
+type Decision struct {
+	Action Action
+	Rule   string
+	Reason string
+}
+
+// Condition : Conditions for rule, all given conditions must be satisfied
+type Condition struct {
+	Domain            []string  `yaml:"domain,omitempty"`
+	Software          []string  `yaml:"software,omitempty"`
+	MinVersion        string    `yaml:"min_version,omitempty"`
+	MaxVersion        string    `yaml:"max_version,omitempty"`
+	OpenRegistrations *bool     `yaml:"open_registrations,omitempty"`
+	MinUsers          *int      `yaml:"min_users,omitempty"`
+	MaxUsers          *int      `yaml:"max_users,omitempty"`
+	MinPosts          *int      `yaml:"min_posts,omitempty"`
+	MaxPosts          *int      `yaml:"max_posts,omitempty"`
+	MinDomainAge      *Duration `yaml:"min_domain_age,omitempty"`
+	MaxSubscribers    *int      `yaml:"max_subscribers,omitempty"`
+	InBlocklist       *bool     `yaml:"in_blocklist,omitempty"`
+	Nodeinfo          *bool     `yaml:"nodeinfo,omitempty"`
+
+	domainPatterns []*regexp.Regexp
+}
+
+// Rule : Policy rule
+type Rule struct {
+	Name   string    `yaml:"name"`
+	Action Action    `yaml:"action"`
+	Reason string    `yaml:"reason,omitempty"`
+	When   Condition `yaml:"when,omitempty"`
+}
+
+// Policy : Auto-accept policy for follow-request
+type Policy struct {
+	Default          Action   `yaml:"default"`
+	DefaultReason    string   `yaml:"default_reason,omitempty"`
+	BlocklistFeeds   []string `yaml:"blocklist_feeds,omitempty"`
+	BlocklistRefresh Duration `yaml:"blocklist_refresh,omitempty"`
+	Rules            []Rule   `yaml:"rules"`
+}
+
+// Load : Read policy from YAML file
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse : Parse policy from YAML data
+func Parse(data []byte) (*Policy, error) {
+	var policy Policy
+	err := yaml.UnmarshalStrict(data, &policy)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Default == "" {
+		policy.Default = Hold
+	}
+	if !validAction(policy.Default) {
+		return nil, errors.New("Invalid default action [" + string(policy.Default) + "] given")
+	}
+	if policy.DefaultReason == "" {
+		policy.DefaultReason = "No rule matched"
+	}
+	if policy.BlocklistRefresh == 0 {
+		policy.BlocklistRefresh = Duration(time.Hour)
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if !validAction(rule.Action) {
+			return nil, errors.New("Invalid action [" + string(rule.Action) + "] given for " + rule.Name)
+		}
+		for _, pattern := range rule.When.Domain {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid domain pattern for %s : %s", rule.Name, err.Error())
+			}
+			rule.When.domainPatterns = append(rule.When.domainPatterns, compiled)
+		}
+	}
+	return &policy, nil
+}
+
+// Evaluate : Evaluate rules in order, first matched rule wins
+func (policy *Policy) Evaluate(subject Subject) Decision {
+	for _, rule := range policy.Rules {
+		if rule.When.match(subject) {
+			reason := rule.Reason
+			if reason == "" {
+				reason = "Matched " + rule.Name
+			}
+			return Decision{rule.Action, rule.Name, reason}
+		}
+	}
+	return Decision{policy.Default, "default", policy.DefaultReason}
+}
+
+func (condition *Condition) match(subject Subject) bool {
+	if len(condition.domainPatterns) > 0 {
+		matched := false
+		for _, pattern := range condition.domainPatterns {
+			if pattern.MatchString(subject.Domain) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if condition.InBlocklist != nil && *condition.InBlocklist != subject.InBlocklist {
+		return false
+	}
+	if condition.MaxSubscribers != nil && subject.Subscribers >= *condition.MaxSubscribers {
+		return false
+	}
+	if condition.MinDomainAge != nil && time.Since(subject.FirstSeen) < time.Duration(*condition.MinDomainAge) {
+		return false
+	}
+	if condition.Nodeinfo != nil && *condition.Nodeinfo != subject.HasNodeinfo {
+		return false
+	}
+	if !condition.needsNodeinfo() {
+		return true
+	}
+	// Conditions depend on nodeinfo never match unknown instances
+	if !subject.HasNodeinfo {
+		return false
+	}
+	if len(condition.Software) > 0 {
+		matched := false
+		for _, software := range condition.Software {
+			if strings.EqualFold(software, subject.Software) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if condition.MinVersion != "" && compareVersion(subject.Version, condition.MinVersion) < 0 {
+		return false
+	}
+	if condition.MaxVersion != "" && compareVersion(subject.Version, condition.MaxVersion) > 0 {
+		return false
+	}
+	if condition.OpenRegistrations != nil && *condition.OpenRegistrations != subject.OpenRegistrations {
+		return false
+	}
+	if (condition.MinUsers != nil || condition.MaxUsers != nil) && subject.Users < 0 {
+		return false
+	}
+	if condition.MinUsers != nil && subject.Users < *condition.MinUsers {
+		return false
+	}
+	if condition.MaxUsers != nil && subject.Users > *condition.MaxUsers {
+		return false
+	}
+	if (condition.MinPosts != nil || condition.MaxPosts != nil) && subject.Posts < 0 {
+		return false
+	}
+	if condition.MinPosts != nil && subject.Posts < *condition.MinPosts {
+		return false
+	}
+	if condition.MaxPosts != nil && subject.Posts > *condition.MaxPosts {
+		return false
+	}
+	return true
+}
+
+func (condition *Condition) needsNodeinfo() bool {
+	return len(condition.Software) > 0 ||
+		condition.MinVersion != "" ||
+		condition.MaxVersion != "" ||
+		condition.OpenRegistrations != nil ||
+		condition.MinUsers != nil ||
+		condition.MaxUsers != nil ||
+		condition.MinPosts != nil ||
+		condition.MaxPosts != nil
+}
+
+func validAction(action Action) bool {
+	switch action {
+	case Accept, Reject, Hold:
+		return true
+	}
+	return false
+}
+
+// compareVersion : Compare dotted version numbers, suffix like "+glitch" or "-rc1" is ignored
+func compareVersion(a string, b string) int {
+	aParts := versionParts(a)
+	bParts := versionParts(b)
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	var parts []int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	for _, part := range strings.Split(version, ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		num, _ := strconv.Atoi(part[:end])
+		parts = append(parts, num)
+		if end < len(part) {
+			break
+		}
+	}
+	return parts
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const examplePolicy = `
+default: hold
+blocklist_feeds:
+  - https://blocklist.example.org/domains.csv
+rules:
+  - name: blocklisted
+    action: reject
+    reason: Listed in blocklist feed
+    when:
+      in_blocklist: true
+  - name: blacklist
+    action: reject
+    when:
+      domain: ["\\.spam\\.example$"]
+  - name: no-nodeinfo
+    action: hold
+    reason: Nodeinfo is unavailable
+    when:
+      nodeinfo: false
+  - name: small-mastodon
+    action: accept
+    reason: Small closed Mastodon instance
+    when:
+      software: ["mastodon"]
+      min_version: "3.0.0"
+      open_registrations: false
+      min_users: 1
+      max_users: 100
+      min_domain_age: 24h
+`
+
+func TestParseInvalidAction(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - name: bad\n    action: kick\n"))
+	if err == nil {
+		t.Fatalf("Failed - Invalid action accepted")
+	}
+}
+
+func TestParseInvalidPattern(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - action: reject\n    when:\n      domain: [\"(\"]\n"))
+	if err == nil {
+		t.Fatalf("Failed - Invalid pattern accepted")
+	}
+}
+
+func TestParseUnknownField(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - action: reject\n    when:\n      max_user: 10\n"))
+	if err == nil {
+		t.Fatalf("Failed - Unknown condition accepted")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Parse([]byte(examplePolicy))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	subjects := []struct {
+		subject Subject
+		action  Action
+		rule    string
+	}{
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "Mastodon", Version: "3.1.3", Users: 10, FirstSeen: old}, Accept, "small-mastodon"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "mastodon", Version: "2.9.3", Users: 10, FirstSeen: old}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "mastodon", Version: "3.1.3", Users: 10, FirstSeen: time.Now()}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "mastodon", Version: "3.1.3", Users: 10, OpenRegistrations: true, FirstSeen: old}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "pleroma", Version: "3.1.3", Users: 10, FirstSeen: old}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "mastodon", Version: "3.1.3", Users: 1000, FirstSeen: old}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, Software: "mastodon", Version: "3.1.3", Users: -1, FirstSeen: old}, Hold, "default"},
+		{Subject{Domain: "a.example.jp", FirstSeen: old}, Hold, "no-nodeinfo"},
+		{Subject{Domain: "b.spam.example", HasNodeinfo: true, Software: "mastodon", Version: "3.1.3", Users: 10, FirstSeen: old}, Reject, "blacklist"},
+		{Subject{Domain: "a.example.jp", HasNodeinfo: true, InBlocklist: true}, Reject, "blocklisted"},
+	}
+	for _, s := range subjects {
+		decision := policy.Evaluate(s.subject)
+		if decision.Action != s.action || decision.Rule != s.rule {
+			t.Fatalf("Failed - %+v evaluated as %+v", s.subject, decision)
+		}
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	if compareVersion("3.1.3+glitch", "3.1.3") != 0 {
+		t.Fatalf("Failed - suffix not ignored")
+	}
+	if compareVersion("3.10.0", "3.9.9") != 1 {
+		t.Fatalf("Failed - compare not numeric")
+	}
+	if compareVersion("2.0.0rc1", "2.0.1") != -1 {
+		t.Fatalf("Failed - compare with suffix")
+	}
+}
+
+func TestBlocklistRefresh(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#domain,#severity\nbad.example,suspend\n\nworse.example\n"))
+	}))
+	defer s.Close()
+
+	blocklist := NewBlocklist()
+	err := blocklist.Refresh(new(http.Client), []string{s.URL}, "test")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if blocklist.Len() != 2 {
+		t.Fatalf("Failed - Blocklist not loaded")
+	}
+	if !blocklist.Contains("bad.example") || !blocklist.Contains("sub.worse.example") {
+		t.Fatalf("Failed - Listed domain not contained")
+	}
+	if blocklist.Contains("good.example") {
+		t.Fatalf("Failed - Not listed domain contained")
+	}
+}
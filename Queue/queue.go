@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/RichardKnop/machinery/v1/tasks"
+	"github.com/go-redis/redis"
+)
+
+// Jobs waiting for ETA are stored in this sorted set by machinery redis broker
+const delayedTasksKey = "delayed_tasks"
+
+// RegistorRetryCount : Retries of registor job, relay job is not retried
+const RegistorRetryCount = 2
+
+// NewHeaders : Headers for new delivery job, created_at is kept on retry
+func NewHeaders() tasks.Headers {
+	return tasks.Headers{"created_at": time.Now().Unix()}
+}
+
+// CreatedAt : Time of job pushed, zero if job has no created_at header
+func CreatedAt(signature *tasks.Signature) time.Time {
+	switch createdAt := signature.Headers["created_at"].(type) {
+	case float64:
+		return time.Unix(int64(createdAt), 0)
+	case int64:
+		return time.Unix(createdAt, 0)
+	}
+	return time.Time{}
+}
+
+// Domain : Destination domain of delivery job
+func Domain(signature *tasks.Signature) string {
+	if len(signature.Args) == 0 {
+		return ""
+	}
+	inboxURL, ok := signature.Args[0].Value.(string)
+	if !ok {
+		return ""
+	}
+	parsed, err := url.Parse(inboxURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+// Stats : Summary of delivery jobs in queue
+type Stats struct {
+	Queued   int
+	Delayed  int
+	Oldest   time.Time
+	ByDomain map[string]int
+	ByTask   map[string]int
+}
+
+type job struct {
+	message   string
+	signature *tasks.Signature
+}
+
+func jobs(redisClient *redis.Client, queue string) ([]job, []job, error) {
+	queued, err := redisClient.LRange(queue, 0, -1).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	delayed, err := redisClient.ZRange(delayedTasksKey, 0, -1).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	decode := func(messages []string) []job {
+		var decoded []job
+		for _, message := range messages {
+			var signature tasks.Signature
+			if json.Unmarshal([]byte(message), &signature) != nil {
+				continue
+			}
+			if signature.RoutingKey != "" && signature.RoutingKey != queue {
+				continue
+			}
+			decoded = append(decoded, job{message, &signature})
+		}
+		return decoded
+	}
+	return decode(queued), decode(delayed), nil
+}
+
+// Inspect : Count jobs in queue and delayed jobs for queue
+func Inspect(redisClient *redis.Client, queue string) (*Stats, error) {
+	queued, delayed, err := jobs(redisClient, queue)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		Queued:   len(queued),
+		Delayed:  len(delayed),
+		ByDomain: map[string]int{},
+		ByTask:   map[string]int{},
+	}
+	for _, j := range append(queued, delayed...) {
+		stats.ByDomain[Domain(j.signature)]++
+		stats.ByTask[j.signature.Name]++
+		createdAt := CreatedAt(j.signature)
+		if !createdAt.IsZero() && (stats.Oldest.IsZero() || createdAt.Before(stats.Oldest)) {
+			stats.Oldest = createdAt
+		}
+	}
+	return stats, nil
+}
+
+// Purge : Drop queued and delayed jobs for domain
+func Purge(redisClient *redis.Client, queue string, domain string) (int, error) {
+	queued, delayed, err := jobs(redisClient, queue)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, j := range queued {
+		if Domain(j.signature) != domain {
+			continue
+		}
+		removed, err := redisClient.LRem(queue, 1, j.message).Result()
+		if err != nil {
+			return purged, err
+		}
+		purged += int(removed)
+	}
+	for _, j := range delayed {
+		if Domain(j.signature) != domain {
+			continue
+		}
+		removed, err := redisClient.ZRem(delayedTasksKey, j.message).Result()
+		if err != nil {
+			return purged, err
+		}
+		purged += int(removed)
+	}
+	return purged, nil
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RichardKnop/machinery/v1/tasks"
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+)
+
+var redisClient *redis.Client
+
+func TestMain(m *testing.M) {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		fmt.Println("Config file is not exists. Use environment variables.")
+		viper.BindEnv("redis_url")
+	}
+	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
+	if err != nil {
+		panic(err)
+	}
+	redisClient = redis.NewClient(redisOption)
+
+	code := m.Run()
+	os.Exit(code)
+	redisClient.FlushAll().Result()
+}
+
+func mockJob(name string, inboxURL string, createdAt time.Time) string {
+	signature := tasks.Signature{
+		Name:       name,
+		RoutingKey: "relay",
+		Headers:    tasks.Headers{"created_at": createdAt.Unix()},
+		Args:       []tasks.Arg{{Name: "inboxURL", Type: "string", Value: inboxURL}, {Name: "body", Type: "string", Value: "data"}},
+	}
+	jsonData, _ := json.Marshal(&signature)
+	return string(jsonData)
+}
+
+func TestInspect(t *testing.T) {
+	redisClient.FlushAll().Result()
+	oldest := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	redisClient.RPush("relay", mockJob("relay", "https://a.example.com/inbox", time.Now()))
+	redisClient.RPush("relay", mockJob("registor", "https://b.example.com/inbox", time.Now()))
+	redisClient.ZAdd(delayedTasksKey, redis.Z{Score: 0, Member: mockJob("relay", "https://a.example.com/inbox", oldest)})
+
+	stats, err := Inspect(redisClient, "relay")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if stats.Queued != 2 || stats.Delayed != 1 {
+		t.Fatalf("Failed - Queue depth is invalid.")
+	}
+	if !stats.Oldest.Equal(oldest) {
+		t.Fatalf("Failed - Oldest job is invalid.")
+	}
+	if stats.ByDomain["a.example.com"] != 2 || stats.ByTask["relay"] != 2 || stats.ByTask["registor"] != 1 {
+		t.Fatalf("Failed - Jobs are not counted.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestPurge(t *testing.T) {
+	redisClient.FlushAll().Result()
+
+	redisClient.RPush("relay", mockJob("relay", "https://a.example.com/inbox", time.Now()))
+	redisClient.RPush("relay", mockJob("relay", "https://b.example.com/inbox", time.Now()))
+	redisClient.ZAdd(delayedTasksKey, redis.Z{Score: 0, Member: mockJob("relay", "https://a.example.com/inbox", time.Now())})
+
+	purged, err := Purge(redisClient, "relay", "a.example.com")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	stats, _ := Inspect(redisClient, "relay")
+	if purged != 2 || stats.Queued != 1 || stats.Delayed != 0 {
+		t.Fatalf("Failed - Jobs for domain not purged.")
+	}
+
+	redisClient.FlushAll().Result()
+}
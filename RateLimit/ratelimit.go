@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Token bucket in redis hash, refilled by redis clock so buckets are shared between replicas
+var tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) + tonumber(clock[2]) / 1000000
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = (1 - tokens) / rate
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(wait)}
+`)
+
+// Limiter : Token bucket rate limiter shared in redis
+type Limiter struct {
+	RedisClient *redis.Client
+}
+
+// NewLimiter : Create Limiter with redis client
+func NewLimiter(redisClient *redis.Client) *Limiter {
+	return &Limiter{RedisClient: redisClient}
+}
+
+// Allow : Take a token from bucket of key, return wait until next token if not allowed
+func (limiter *Limiter) Allow(key string, rate float64, burst int) (bool, time.Duration, error) {
+	if burst < 1 {
+		burst = 1
+	}
+	result, err := tokenBucket.Run(limiter.RedisClient, []string{"relay:ratelimit:" + key}, rate, burst).Result()
+	if err != nil {
+		return true, 0, err
+	}
+	values := result.([]interface{})
+	allowed, _ := values[0].(int64)
+	wait, _ := strconv.ParseFloat(values[1].(string), 64)
+	return allowed == 1, time.Duration(wait * float64(time.Second)), nil
+}
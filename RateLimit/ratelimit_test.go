@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+)
+
+var redisClient *redis.Client
+
+func TestMain(m *testing.M) {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		fmt.Println("Config file is not exists. Use environment variables.")
+		viper.BindEnv("redis_url")
+	}
+	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
+	if err != nil {
+		panic(err)
+	}
+	redisClient = redis.NewClient(redisOption)
+
+	code := m.Run()
+	os.Exit(code)
+	redisClient.FlushAll().Result()
+}
+
+func TestAllowBurst(t *testing.T) {
+	redisClient.FlushAll().Result()
+	limiter := NewLimiter(redisClient)
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow("domain:example.com", 1, 3)
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		if !allowed {
+			t.Fatalf("Failed - Request in burst not allowed.")
+		}
+	}
+	allowed, wait, _ := limiter.Allow("domain:example.com", 1, 3)
+	if allowed {
+		t.Fatalf("Failed - Request over burst allowed.")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("Failed - Wait is invalid : %s", wait)
+	}
+	allowed, _, _ = limiter.Allow("domain:example.org", 1, 3)
+	if !allowed {
+		t.Fatalf("Failed - Bucket shared between keys.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAllowRefill(t *testing.T) {
+	redisClient.FlushAll().Result()
+	limiter := NewLimiter(redisClient)
+
+	limiter.Allow("ip:192.0.2.1", 20, 1)
+	allowed, _, _ := limiter.Allow("ip:192.0.2.1", 20, 1)
+	if allowed {
+		t.Fatalf("Failed - Request over burst allowed.")
+	}
+	time.Sleep(100 * time.Millisecond)
+	allowed, _, _ = limiter.Allow("ip:192.0.2.1", 20, 1)
+	if !allowed {
+		t.Fatalf("Failed - Bucket not refilled.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAcquireRelease(t *testing.T) {
+	redisClient.FlushAll().Result()
+	limiter := NewLimiter(redisClient)
+
+	first, _ := limiter.Acquire("example.com", 2, time.Minute)
+	second, _ := limiter.Acquire("example.com", 2, time.Minute)
+	if first == "" || second == "" {
+		t.Fatalf("Failed - Slot in limit not acquired.")
+	}
+	third, _ := limiter.Acquire("example.com", 2, time.Minute)
+	if third != "" {
+		t.Fatalf("Failed - Slot over limit acquired.")
+	}
+	limiter.Release("example.com", first)
+	third, _ = limiter.Acquire("example.com", 2, time.Minute)
+	if third == "" {
+		t.Fatalf("Failed - Released slot not acquired.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAcquireLeaseExpired(t *testing.T) {
+	redisClient.FlushAll().Result()
+	limiter := NewLimiter(redisClient)
+
+	limiter.Acquire("example.com", 1, 50*time.Millisecond)
+	token, _ := limiter.Acquire("example.com", 1, 50*time.Millisecond)
+	if token != "" {
+		t.Fatalf("Failed - Slot over limit acquired.")
+	}
+	time.Sleep(100 * time.Millisecond)
+	token, _ = limiter.Acquire("example.com", 1, 50*time.Millisecond)
+	if token == "" {
+		t.Fatalf("Failed - Expired slot not reclaimed.")
+	}
+
+	redisClient.FlushAll().Result()
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Slots in redis sorted set scored by lease expiry, so slots of crashed holders are reclaimed
+var slotAcquire = redis.NewScript(`
+redis.replicate_commands()
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local lease = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], now + lease, ARGV[3])
+redis.call("PEXPIRE", KEYS[1], lease)
+return 1
+`)
+
+// Acquire : Take one of limit slots of key for lease, return token to release slot or empty token if all slots are taken
+func (limiter *Limiter) Acquire(key string, limit int, lease time.Duration) (string, error) {
+	token := uuid.NewV4().String()
+	acquired, err := slotAcquire.Run(limiter.RedisClient, []string{"relay:concurrency:" + key}, limit, int64(lease/time.Millisecond), token).Int64()
+	if err != nil {
+		return token, err
+	}
+	if acquired != 1 {
+		return "", nil
+	}
+	return token, nil
+}
+
+// Release : Return slot of key taken by Acquire
+func (limiter *Limiter) Release(key string, token string) error {
+	return limiter.RedisClient.ZRem("relay:concurrency:"+key, token).Err()
+}
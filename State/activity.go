@@ -0,0 +1,75 @@
+package state
+
+import "time"
+
+const (
+	// DefaultActivityLimit : Number of stored activities when ActivityLimit is not set
+	DefaultActivityLimit = 1000
+	// DefaultActivityTTL : Expiration of stored activities when ActivityTTL is not set
+	DefaultActivityTTL = 7 * 24 * time.Hour
+)
+
+// AddActivity : Store relay generated activity, public one is also listed in outbox
+func (config *RelayState) AddActivity(id string, body []byte, public bool) error {
+	limit := int64(config.ActivityLimit)
+	if limit <= 0 {
+		limit = DefaultActivityLimit
+	}
+	ttl := config.ActivityTTL
+	if ttl <= 0 {
+		ttl = DefaultActivityTTL
+	}
+	pipe := config.RedisClient.TxPipeline()
+	pipe.Set("relay:activity:"+id, body, ttl)
+	pipe.LPush("relay:activities", id)
+	if public {
+		pipe.LPush("relay:outbox", id)
+	}
+	_, err := pipe.Exec()
+	if err != nil {
+		return err
+	}
+
+	evicted, err := config.RedisClient.LRange("relay:activities", limit, -1).Result()
+	if err != nil || len(evicted) == 0 {
+		return err
+	}
+	pipe = config.RedisClient.TxPipeline()
+	pipe.LTrim("relay:activities", 0, limit-1)
+	for _, evictedID := range evicted {
+		pipe.Del("relay:activity:" + evictedID)
+		pipe.LRem("relay:outbox", 0, evictedID)
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+// SelectActivity : Get stored activity by id
+func (config *RelayState) SelectActivity(id string) ([]byte, error) {
+	return config.RedisClient.Get("relay:activity:" + id).Bytes()
+}
+
+// CountOutbox : Count public activities in outbox
+func (config *RelayState) CountOutbox() (int, error) {
+	total, err := config.RedisClient.LLen("relay:outbox").Result()
+	return int(total), err
+}
+
+// ListOutbox : List public activities newest first, expired one is removed from outbox
+func (config *RelayState) ListOutbox(offset int, count int) ([][]byte, error) {
+	ids, err := config.RedisClient.LRange("relay:outbox", int64(offset), int64(offset+count-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var activities [][]byte
+	for _, id := range ids {
+		body, err := config.SelectActivity(id)
+		if err != nil {
+			config.RedisClient.LRem("relay:outbox", 0, id)
+			config.RedisClient.LRem("relay:activities", 0, id)
+			continue
+		}
+		activities = append(activities, body)
+	}
+	return activities, nil
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAddActivity(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddActivity("https://relay.example.com/activities/1", []byte(`{"type":"Accept"}`), false)
+	testState.AddActivity("https://relay.example.com/activities/2", []byte(`{"type":"Announce"}`), true)
+
+	body, err := testState.SelectActivity("https://relay.example.com/activities/1")
+	if err != nil || string(body) != `{"type":"Accept"}` {
+		t.Fatalf("Failed - Activity not stored.")
+	}
+	activities, err := testState.ListOutbox(0, 10)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	total, _ := testState.CountOutbox()
+	if total != 1 || len(activities) != 1 || string(activities[0]) != `{"type":"Announce"}` {
+		t.Fatalf("Failed - Outbox is invalid.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAddActivityLimit(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+	testState.ActivityLimit = 3
+
+	for i := 0; i < 5; i++ {
+		testState.AddActivity("https://relay.example.com/activities/"+strconv.Itoa(i), []byte(strconv.Itoa(i)), true)
+	}
+
+	_, err := testState.SelectActivity("https://relay.example.com/activities/1")
+	if err == nil {
+		t.Fatalf("Failed - Evicted activity remains.")
+	}
+	activities, _ := testState.ListOutbox(0, 10)
+	total, _ := testState.CountOutbox()
+	if total != 3 || len(activities) != 3 || string(activities[0]) != "4" {
+		t.Fatalf("Failed - Outbox not trimmed.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAddAnnounce(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddAnnounce("https://example.com/notes/1", "https://relay.example.com/activities/1", "https://example.com/users/example")
+	announceID, actorID, err := testState.SelectAnnounce("https://example.com/notes/1")
+	if err != nil || announceID != "https://relay.example.com/activities/1" || actorID != "https://example.com/users/example" {
+		t.Fatalf("Failed - Announce not stored.")
+	}
+	ttl, _ := redisClient.TTL("relay:announce:https://example.com/notes/1").Result()
+	if ttl <= 0 || ttl > DefaultAnnounceTTL {
+		t.Fatalf("Failed - Announce does not expire.")
+	}
+	testState.DelAnnounce("https://example.com/notes/1")
+	_, _, err = testState.SelectAnnounce("https://example.com/notes/1")
+	if err == nil {
+		t.Fatalf("Failed - Announce not deleted.")
+	}
+
+	redisClient.FlushAll().Result()
+}
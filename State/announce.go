@@ -0,0 +1,46 @@
+package state
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultAnnounceTTL : Expiration of object to Announce mapping when AnnounceTTL is not set
+const DefaultAnnounceTTL = 30 * 24 * time.Hour
+
+// AddAnnounce : Remember relay's Announce ID of announced object with actor of announced activity
+func (config *RelayState) AddAnnounce(objectID string, announceID string, actorID string) error {
+	ttl := config.AnnounceTTL
+	if ttl <= 0 {
+		ttl = DefaultAnnounceTTL
+	}
+	pipe := config.RedisClient.TxPipeline()
+	pipe.Del("relay:announce:" + objectID)
+	pipe.HMSet("relay:announce:"+objectID, map[string]interface{}{
+		"announce_id": announceID,
+		"actor_id":    actorID,
+	})
+	pipe.Expire("relay:announce:"+objectID, ttl)
+	_, err := pipe.Exec()
+	return err
+}
+
+// SelectAnnounce : Get relay's Announce ID of announced object and actor of announced activity
+func (config *RelayState) SelectAnnounce(objectID string) (string, string, error) {
+	values, err := config.RedisClient.HMGet("relay:announce:"+objectID, "announce_id", "actor_id").Result()
+	if err != nil {
+		return "", "", err
+	}
+	announceID, _ := values[0].(string)
+	actorID, _ := values[1].(string)
+	if announceID == "" {
+		return "", "", redis.Nil
+	}
+	return announceID, actorID, nil
+}
+
+// DelAnnounce : Forget relay's Announce of object
+func (config *RelayState) DelAnnounce(objectID string) error {
+	return config.RedisClient.Del("relay:announce:" + objectID).Err()
+}
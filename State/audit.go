@@ -0,0 +1,93 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultAuditLogSize : Number of kept audit entries when AuditLogSize is not set
+const DefaultAuditLogSize = 10000
+
+// AuditAction : Kind of recorded decision
+type AuditAction string
+
+const (
+	// AuditAccept : Follow-request accepted
+	AuditAccept AuditAction = "accept"
+	// AuditReject : Follow-request rejected
+	AuditReject AuditAction = "reject"
+	// AuditKick : Subscriber unfollowed by relay
+	AuditKick AuditAction = "kick"
+	// AuditBlock : Domain set as blocked
+	AuditBlock AuditAction = "block"
+	// AuditUnblock : Domain unset as blocked
+	AuditUnblock AuditAction = "unblock"
+	// AuditLimit : Domain set as limited
+	AuditLimit AuditAction = "limit"
+	// AuditUnlimit : Domain unset as limited
+	AuditUnlimit AuditAction = "unlimit"
+	// AuditConfig : Relay configuration changed
+	AuditConfig AuditAction = "config"
+	// AuditResolve : Report resolved
+	AuditResolve AuditAction = "resolve"
+)
+
+// AuditEntry : Record of follow, kick and moderation decision
+type AuditEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Actor     string      `json:"actor"`
+	Action    AuditAction `json:"action"`
+	Domain    string      `json:"domain,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// AddAudit : Append entry to audit log, oldest entries over AuditLogSize are dropped
+func (config *RelayState) AddAudit(actor string, action AuditAction, domain string, reason string) error {
+	entry := AuditEntry{
+		Timestamp: time.Now().UTC(),
+		Actor:     actor,
+		Action:    action,
+		Domain:    domain,
+		Reason:    reason,
+	}
+	jsonData, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	limit := int64(config.AuditLogSize)
+	if limit <= 0 {
+		limit = DefaultAuditLogSize
+	}
+	pipe := config.RedisClient.TxPipeline()
+	pipe.RPush("relay:audit", jsonData)
+	pipe.LTrim("relay:audit", -limit, -1)
+	_, err = pipe.Exec()
+	return err
+}
+
+// ListAudit : List audit entries filtered by domain and time range, empty domain or zero time means unfiltered
+func (config *RelayState) ListAudit(domain string, since time.Time, until time.Time) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	records, err := config.RedisClient.LRange("relay:audit", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		var entry AuditEntry
+		err = json.Unmarshal([]byte(record), &entry)
+		if err != nil {
+			continue
+		}
+		if domain != "" && entry.Domain != domain {
+			continue
+		}
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			continue
+		}
+		if !until.IsZero() && entry.Timestamp.After(until) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
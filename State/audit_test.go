@@ -0,0 +1,67 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddAudit(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddAudit("cli:admin", AuditBlock, "example.com", "spam")
+	testState.AddAudit("spy", AuditKick, "example.org", "user count is 1000")
+
+	entries, err := testState.ListAudit("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Failed - Audit entries not stored.")
+	}
+	if entries[0].Actor != "cli:admin" || entries[0].Action != AuditBlock || entries[0].Domain != "example.com" || entries[0].Reason != "spam" {
+		t.Fatalf("Failed - Audit entry is invalid.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestAuditLogSize(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+	testState.AuditLogSize = 2
+
+	testState.AddAudit("cli:admin", AuditBlock, "a.example.com", "spam")
+	testState.AddAudit("cli:admin", AuditBlock, "b.example.com", "spam")
+	testState.AddAudit("cli:admin", AuditBlock, "c.example.com", "spam")
+
+	entries, _ := testState.ListAudit("", time.Time{}, time.Time{})
+	if len(entries) != 2 || entries[0].Domain != "b.example.com" || entries[1].Domain != "c.example.com" {
+		t.Fatalf("Failed - Oldest audit entry not dropped.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestListAuditFilter(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddAudit("spy", AuditAccept, "example.com", "")
+	testState.AddAudit("spy", AuditAccept, "example.org", "")
+
+	entries, _ := testState.ListAudit("example.org", time.Time{}, time.Time{})
+	if len(entries) != 1 || entries[0].Domain != "example.org" {
+		t.Fatalf("Failed - Domain filter not works.")
+	}
+	entries, _ = testState.ListAudit("", time.Now().Add(time.Hour), time.Time{})
+	if len(entries) != 0 {
+		t.Fatalf("Failed - Since filter not works.")
+	}
+	entries, _ = testState.ListAudit("", time.Time{}, time.Now().Add(-time.Hour))
+	if len(entries) != 0 {
+		t.Fatalf("Failed - Until filter not works.")
+	}
+
+	redisClient.FlushAll().Result()
+}
@@ -0,0 +1,152 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultDeadLetterLimit : Number of stored dead letters when DeadLetterLimit is not set
+	DefaultDeadLetterLimit = 10000
+	// DefaultDeadLetterTTL : Expiration of dead letters when DeadLetterTTL is not set
+	DefaultDeadLetterTTL = 7 * 24 * time.Hour
+)
+
+// ErrDeadLetterNotFound : Dead letter is not exist or expired
+var ErrDeadLetterNotFound = errors.New("Dead letter is not found")
+
+// DeadLetter : Delivery job given up by worker
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Task     string    `json:"task"`
+	Domain   string    `json:"domain"`
+	InboxURL string    `json:"inbox_url"`
+	BodyRef  string    `json:"body_ref"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func (config *RelayState) deadLetterTTL() time.Duration {
+	if config.DeadLetterTTL <= 0 {
+		return DefaultDeadLetterTTL
+	}
+	return config.DeadLetterTTL
+}
+
+// AddDeadLetter : Store given up job, body is shared by jobs of same activity, oldest one is evicted over limit
+func (config *RelayState) AddDeadLetter(letter DeadLetter, body []byte) error {
+	limit := int64(config.DeadLetterLimit)
+	if limit <= 0 {
+		limit = DefaultDeadLetterLimit
+	}
+	hash := sha256.Sum256(body)
+	letter.BodyRef = hex.EncodeToString(hash[:])
+	if letter.FailedAt.IsZero() {
+		letter.FailedAt = time.Now().UTC()
+	}
+	jsonData, err := json.Marshal(&letter)
+	if err != nil {
+		return err
+	}
+	pipe := config.RedisClient.TxPipeline()
+	pipe.Set("relay:deadletter:body:"+letter.BodyRef, body, config.deadLetterTTL())
+	pipe.HSet("relay:deadletter", letter.ID, jsonData)
+	pipe.LRem("relay:deadletters", 0, letter.ID)
+	pipe.LPush("relay:deadletters", letter.ID)
+	// Whole store is expired when no job is given up for a while
+	pipe.Expire("relay:deadletter", config.deadLetterTTL())
+	pipe.Expire("relay:deadletters", config.deadLetterTTL())
+	_, err = pipe.Exec()
+	if err != nil {
+		return err
+	}
+
+	evicted, err := config.RedisClient.LRange("relay:deadletters", limit, -1).Result()
+	if err != nil || len(evicted) == 0 {
+		return err
+	}
+	pipe = config.RedisClient.TxPipeline()
+	pipe.LTrim("relay:deadletters", 0, limit-1)
+	pipe.HDel("relay:deadletter", evicted...)
+	_, err = pipe.Exec()
+	return err
+}
+
+// ListDeadLetters : List dead letters oldest first filtered by domain, empty domain means unfiltered, expired one is removed
+func (config *RelayState) ListDeadLetters(domain string) ([]DeadLetter, error) {
+	records, err := config.RedisClient.HGetAll("relay:deadletter").Result()
+	if err != nil {
+		return nil, err
+	}
+	expiry := time.Now().Add(-config.deadLetterTTL())
+	var letters []DeadLetter
+	for id, record := range records {
+		var letter DeadLetter
+		if json.Unmarshal([]byte(record), &letter) != nil || letter.FailedAt.Before(expiry) {
+			config.DelDeadLetter(id)
+			continue
+		}
+		if domain != "" && letter.Domain != domain {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// SelectDeadLetter : Get dead letter and its body by id
+func (config *RelayState) SelectDeadLetter(id string) (*DeadLetter, []byte, error) {
+	record, err := config.RedisClient.HGet("relay:deadletter", id).Result()
+	if err != nil {
+		return nil, nil, ErrDeadLetterNotFound
+	}
+	var letter DeadLetter
+	err = json.Unmarshal([]byte(record), &letter)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := config.RedisClient.Get("relay:deadletter:body:" + letter.BodyRef).Bytes()
+	if err != nil {
+		config.DelDeadLetter(id)
+		return nil, nil, ErrDeadLetterNotFound
+	}
+	return &letter, body, nil
+}
+
+// DelDeadLetter : Delete dead letter, body is left until expired for other letters
+func (config *RelayState) DelDeadLetter(id string) error {
+	pipe := config.RedisClient.TxPipeline()
+	pipe.HDel("relay:deadletter", id)
+	pipe.LRem("relay:deadletters", 0, id)
+	_, err := pipe.Exec()
+	return err
+}
+
+// PurgeDeadLetters : Delete dead letters filtered by domain, empty domain means all
+func (config *RelayState) PurgeDeadLetters(domain string) (int, error) {
+	if domain == "" {
+		total, err := config.RedisClient.HLen("relay:deadletter").Result()
+		if err != nil {
+			return 0, err
+		}
+		bodies, _ := config.RedisClient.Keys("relay:deadletter:body:*").Result()
+		keys := append(bodies, "relay:deadletter", "relay:deadletters")
+		return int(total), config.RedisClient.Del(keys...).Err()
+	}
+	letters, err := config.ListDeadLetters(domain)
+	if err != nil {
+		return 0, err
+	}
+	for _, letter := range letters {
+		config.DelDeadLetter(letter.ID)
+	}
+	return len(letters), nil
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddDeadLetter(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	body := []byte(`{"type":"Announce"}`)
+	testState.AddDeadLetter(DeadLetter{ID: "1", Task: "relay", Domain: "a.example.com", InboxURL: "https://a.example.com/inbox", Error: "500", Attempts: 1}, body)
+	testState.AddDeadLetter(DeadLetter{ID: "2", Task: "relay", Domain: "b.example.com", InboxURL: "https://b.example.com/inbox", Error: "500", Attempts: 1}, body)
+
+	letters, err := testState.ListDeadLetters("")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if len(letters) != 2 || letters[0].BodyRef != letters[1].BodyRef {
+		t.Fatalf("Failed - Body is not shared.")
+	}
+	letters, _ = testState.ListDeadLetters("b.example.com")
+	if len(letters) != 1 || letters[0].ID != "2" {
+		t.Fatalf("Failed - Domain filter not works.")
+	}
+	letter, stored, err := testState.SelectDeadLetter("1")
+	if err != nil || letter.InboxURL != "https://a.example.com/inbox" || string(stored) != string(body) {
+		t.Fatalf("Failed - Dead letter not stored.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestDeadLetterExpired(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+	testState.DeadLetterTTL = time.Hour
+
+	testState.AddDeadLetter(DeadLetter{ID: "1", Domain: "a.example.com", FailedAt: time.Now().Add(-2 * time.Hour)}, []byte("old"))
+	testState.AddDeadLetter(DeadLetter{ID: "2", Domain: "a.example.com"}, []byte("new"))
+
+	letters, _ := testState.ListDeadLetters("")
+	if len(letters) != 1 || letters[0].ID != "2" {
+		t.Fatalf("Failed - Expired dead letter listed.")
+	}
+	_, _, err := testState.SelectDeadLetter("1")
+	if err != ErrDeadLetterNotFound {
+		t.Fatalf("Failed - Expired dead letter not removed.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+	testState.DeadLetterLimit = 2
+
+	testState.AddDeadLetter(DeadLetter{ID: "1", Domain: "a.example.com"}, []byte("1"))
+	testState.AddDeadLetter(DeadLetter{ID: "2", Domain: "a.example.com"}, []byte("2"))
+	testState.AddDeadLetter(DeadLetter{ID: "3", Domain: "a.example.com"}, []byte("3"))
+
+	letters, _ := testState.ListDeadLetters("")
+	if len(letters) != 2 || letters[0].ID != "2" || letters[1].ID != "3" {
+		t.Fatalf("Failed - Oldest dead letter not evicted.")
+	}
+	ttl, _ := redisClient.TTL("relay:deadletter").Result()
+	if ttl <= 0 {
+		t.Fatalf("Failed - Dead-letter store not expired.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddDeadLetter(DeadLetter{ID: "1", Domain: "a.example.com"}, []byte("1"))
+	testState.AddDeadLetter(DeadLetter{ID: "2", Domain: "b.example.com"}, []byte("2"))
+	testState.AddDeadLetter(DeadLetter{ID: "3", Domain: "b.example.com"}, []byte("3"))
+
+	purged, _ := testState.PurgeDeadLetters("b.example.com")
+	letters, _ := testState.ListDeadLetters("")
+	if purged != 2 || len(letters) != 1 {
+		t.Fatalf("Failed - Domain purge not works.")
+	}
+	purged, _ = testState.PurgeDeadLetters("")
+	letters, _ = testState.ListDeadLetters("")
+	if purged != 1 || len(letters) != 0 {
+		t.Fatalf("Failed - Purge not works.")
+	}
+
+	redisClient.FlushAll().Result()
+}
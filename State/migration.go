@@ -0,0 +1,73 @@
+package state
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// DefaultMigrationLogSize : Number of kept migrations when MigrationLogSize is not set
+const DefaultMigrationLogSize = 10000
+
+// Migration : Record of verified account migration by Move activity
+type Migration struct {
+	Timestamp  time.Time `json:"timestamp"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	ActivityID string    `json:"activity_id,omitempty"`
+}
+
+// AddMigration : Append account migration to migration log, oldest migrations over MigrationLogSize are dropped
+func (config *RelayState) AddMigration(from string, to string, activityID string) error {
+	migration := Migration{
+		Timestamp:  time.Now().UTC(),
+		From:       from,
+		To:         to,
+		ActivityID: activityID,
+	}
+	jsonData, err := json.Marshal(&migration)
+	if err != nil {
+		return err
+	}
+	limit := int64(config.MigrationLogSize)
+	if limit <= 0 {
+		limit = DefaultMigrationLogSize
+	}
+	pipe := config.RedisClient.TxPipeline()
+	pipe.RPush("relay:migration", jsonData)
+	pipe.LTrim("relay:migration", -limit, -1)
+	_, err = pipe.Exec()
+	return err
+}
+
+// ListMigrations : List account migrations from or to given account or domain, empty account and domain mean unfiltered
+func (config *RelayState) ListMigrations(account string, domain string) ([]Migration, error) {
+	var migrations []Migration
+	records, err := config.RedisClient.LRange("relay:migration", 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		var migration Migration
+		err = json.Unmarshal([]byte(record), &migration)
+		if err != nil {
+			continue
+		}
+		if account != "" && migration.From != account && migration.To != account {
+			continue
+		}
+		if domain != "" && hostOf(migration.From) != domain && hostOf(migration.To) != domain {
+			continue
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+func hostOf(account string) string {
+	accountURL, err := url.Parse(account)
+	if err != nil {
+		return ""
+	}
+	return accountURL.Host
+}
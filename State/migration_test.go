@@ -0,0 +1,46 @@
+package state
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestListMigrations(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddMigration("https://a.example.com/users/example", "https://b.example.com/users/example", "https://a.example.com/users/example#moves/1")
+	testState.AddMigration("https://c.example.com/users/other", "https://d.example.com/users/other", "")
+
+	migrations, err := testState.ListMigrations("", "")
+	if err != nil || len(migrations) != 2 {
+		t.Fatalf("Failed - Migrations not stored.")
+	}
+	migrations, _ = testState.ListMigrations("https://b.example.com/users/example", "")
+	if len(migrations) != 1 || migrations[0].From != "https://a.example.com/users/example" || migrations[0].ActivityID != "https://a.example.com/users/example#moves/1" {
+		t.Fatalf("Failed - Migrations not filtered by account.")
+	}
+	migrations, _ = testState.ListMigrations("", "c.example.com")
+	if len(migrations) != 1 || migrations[0].To != "https://d.example.com/users/other" {
+		t.Fatalf("Failed - Migrations not filtered by domain.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestMigrationLogSize(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+	testState.MigrationLogSize = 2
+
+	for i := 1; i <= 3; i++ {
+		testState.AddMigration("https://a.example.com/users/"+strconv.Itoa(i), "https://b.example.com/users/"+strconv.Itoa(i), "")
+	}
+
+	migrations, _ := testState.ListMigrations("", "")
+	if len(migrations) != 2 || migrations[0].From != "https://a.example.com/users/2" || migrations[1].From != "https://a.example.com/users/3" {
+		t.Fatalf("Failed - Oldest migration not dropped.")
+	}
+
+	redisClient.FlushAll().Result()
+}
@@ -0,0 +1,32 @@
+package state
+
+import "time"
+
+// DefaultRelayedTTL : Expiration of relayed activity ID when RelayedTTL is not set
+const DefaultRelayedTTL = 7 * 24 * time.Hour
+
+// MarkRelayed : Record activity ID as relayed, false if it is already relayed
+func (config *RelayState) MarkRelayed(activityID string) (bool, error) {
+	if activityID == "" {
+		return true, nil
+	}
+	ttl := config.RelayedTTL
+	if ttl <= 0 {
+		ttl = DefaultRelayedTTL
+	}
+	return config.RedisClient.SetNX("relay:relayed:"+activityID, time.Now().Unix(), ttl).Result()
+}
+
+// IsRelayed : Check activity ID is relayed
+func (config *RelayState) IsRelayed(activityID string) bool {
+	if activityID == "" {
+		return false
+	}
+	exists, err := config.RedisClient.Exists("relay:relayed:" + activityID).Result()
+	return err == nil && exists == 1
+}
+
+// UnmarkRelayed : Forget relayed activity ID
+func (config *RelayState) UnmarkRelayed(activityID string) error {
+	return config.RedisClient.Del("relay:relayed:" + activityID).Err()
+}
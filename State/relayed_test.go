@@ -0,0 +1,30 @@
+package state
+
+import "testing"
+
+func TestMarkRelayed(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	marked, err := testState.MarkRelayed("https://example.com/activities/1")
+	if err != nil || !marked {
+		t.Fatalf("Failed - Activity not marked.")
+	}
+	marked, _ = testState.MarkRelayed("https://example.com/activities/1")
+	if marked {
+		t.Fatalf("Failed - Activity marked twice.")
+	}
+	if !testState.IsRelayed("https://example.com/activities/1") || testState.IsRelayed("https://example.com/activities/2") {
+		t.Fatalf("Failed - Invalid relayed state.")
+	}
+	ttl, _ := redisClient.TTL("relay:relayed:https://example.com/activities/1").Result()
+	if ttl <= 0 || ttl > DefaultRelayedTTL {
+		t.Fatalf("Failed - Relayed activity does not expire.")
+	}
+	testState.UnmarkRelayed("https://example.com/activities/1")
+	if testState.IsRelayed("https://example.com/activities/1") {
+		t.Fatalf("Failed - Activity not unmarked.")
+	}
+
+	redisClient.FlushAll().Result()
+}
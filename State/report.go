@@ -0,0 +1,144 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrReportNotFound : Report is not exist or already resolved
+var ErrReportNotFound = errors.New("Report is not found")
+
+// ErrReportActionNotFound : Action on reported domain is not queued or already applied
+var ErrReportActionNotFound = errors.New("Report action is not found")
+
+// Report : Flag activity received from subscriber, waiting to be resolved by relay admin
+type Report struct {
+	ID         string    `json:"id"`
+	Reporter   string    `json:"reporter"`
+	Domain     string    `json:"domain"`
+	Objects    []string  `json:"objects"`
+	Content    string    `json:"content,omitempty"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// ReportedDomains : Domains of reported accounts and objects
+func (report *Report) ReportedDomains() []string {
+	var domains []string
+	for _, object := range report.Objects {
+		domain := hostOf(object)
+		if domain != "" && !hasDomain(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+func hasDomain(domains []string, domain string) bool {
+	for _, entry := range domains {
+		if entry == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReport : Store report until resolved
+func (config *RelayState) AddReport(report Report) error {
+	if report.ReportedAt.IsZero() {
+		report.ReportedAt = time.Now().UTC()
+	}
+	jsonData, err := json.Marshal(&report)
+	if err != nil {
+		return err
+	}
+	return config.RedisClient.HSet("relay:report", report.ID, jsonData).Err()
+}
+
+// ListReports : List unresolved reports oldest first filtered by domain of reporter or reported, empty domain means unfiltered
+func (config *RelayState) ListReports(domain string) ([]Report, error) {
+	records, err := config.RedisClient.HGetAll("relay:report").Result()
+	if err != nil {
+		return nil, err
+	}
+	var reports []Report
+	for _, record := range records {
+		var report Report
+		if json.Unmarshal([]byte(record), &report) != nil {
+			continue
+		}
+		if domain != "" && report.Domain != domain && !hasDomain(report.ReportedDomains(), domain) {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ReportedAt.Before(reports[j].ReportedAt)
+	})
+	return reports, nil
+}
+
+// ResolveReport : Remove resolved report
+func (config *RelayState) ResolveReport(id string) error {
+	deleted, err := config.RedisClient.HDel("relay:report", id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
+
+// ReportAction : Action on reported domain, waiting to be applied or dismissed by relay admin
+type ReportAction struct {
+	Domain   string    `json:"domain"`
+	Action   string    `json:"action"`
+	Reason   string    `json:"reason,omitempty"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// QueueReportAction : Store action on reported domain until applied or dismissed, queued action of domain is replaced
+func (config *RelayState) QueueReportAction(action ReportAction) error {
+	if action.QueuedAt.IsZero() {
+		action.QueuedAt = time.Now().UTC()
+	}
+	jsonData, err := json.Marshal(&action)
+	if err != nil {
+		return err
+	}
+	return config.RedisClient.HSet("relay:report:action", action.Domain, jsonData).Err()
+}
+
+// ListReportActions : List queued actions on reported domains oldest first
+func (config *RelayState) ListReportActions() ([]ReportAction, error) {
+	records, err := config.RedisClient.HGetAll("relay:report:action").Result()
+	if err != nil {
+		return nil, err
+	}
+	var actions []ReportAction
+	for _, record := range records {
+		var action ReportAction
+		if json.Unmarshal([]byte(record), &action) != nil {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].QueuedAt.Before(actions[j].QueuedAt)
+	})
+	return actions, nil
+}
+
+// DelReportAction : Remove applied or dismissed action on reported domain
+func (config *RelayState) DelReportAction(domain string) error {
+	deleted, err := config.RedisClient.HDel("relay:report:action", domain).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrReportActionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.AddReport(Report{ID: "2", Reporter: "https://a.example.com/actor", Domain: "a.example.com", Objects: []string{"https://spam.example.com/users/spam"}, ReportedAt: time.Now()})
+	testState.AddReport(Report{ID: "1", Reporter: "https://b.example.com/actor", Domain: "b.example.com", Objects: []string{"https://other.example.com/users/other", "https://other.example.com/notes/1"}, ReportedAt: time.Now().Add(-time.Hour)})
+
+	reports, err := testState.ListReports("")
+	if err != nil || len(reports) != 2 || reports[0].ID != "1" {
+		t.Fatalf("Failed - Reports not listed oldest first.")
+	}
+	if domains := reports[0].ReportedDomains(); len(domains) != 1 || domains[0] != "other.example.com" {
+		t.Fatalf("Failed - Invalid reported domains.")
+	}
+	reports, _ = testState.ListReports("spam.example.com")
+	if len(reports) != 1 || reports[0].ID != "2" {
+		t.Fatalf("Failed - Reports not filtered by reported domain.")
+	}
+	reports, _ = testState.ListReports("b.example.com")
+	if len(reports) != 1 || reports[0].ID != "1" {
+		t.Fatalf("Failed - Reports not filtered by reporter domain.")
+	}
+
+	err = testState.ResolveReport("1")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	err = testState.ResolveReport("1")
+	if err != ErrReportNotFound {
+		t.Fatalf("Failed - Resolved report resolved again.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestReportAction(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.QueueReportAction(ReportAction{Domain: "spam.example.com", Action: "block", Reason: "Reported by a.example.com", QueuedAt: time.Now()})
+	testState.QueueReportAction(ReportAction{Domain: "other.example.com", Action: "limit", QueuedAt: time.Now().Add(-time.Hour)})
+
+	actions, err := testState.ListReportActions()
+	if err != nil || len(actions) != 2 || actions[0].Domain != "other.example.com" || actions[1].Action != "block" {
+		t.Fatalf("Failed - Report actions not listed oldest first.")
+	}
+
+	err = testState.DelReportAction("other.example.com")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	err = testState.DelReportAction("other.example.com")
+	if err != ErrReportActionNotFound {
+		t.Fatalf("Failed - Removed report action removed again.")
+	}
+
+	redisClient.FlushAll().Result()
+}
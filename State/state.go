@@ -1,8 +1,11 @@
 package state
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
 )
@@ -23,11 +26,29 @@ const (
 type RelayState struct {
 	RedisClient *redis.Client
 	notifiable  bool
+	// ActivityLimit : Max number of stored relay generated activities
+	ActivityLimit int `json:"-"`
+	// ActivityTTL : Expiration of stored relay generated activities
+	ActivityTTL time.Duration `json:"-"`
+	// DeadLetterLimit : Max number of stored given up delivery jobs
+	DeadLetterLimit int `json:"-"`
+	// DeadLetterTTL : Expiration of given up delivery jobs
+	DeadLetterTTL time.Duration `json:"-"`
+	// AuditLogSize : Max number of kept audit entries
+	AuditLogSize int `json:"-"`
+	// MigrationLogSize : Max number of kept account migrations
+	MigrationLogSize int `json:"-"`
+	// AnnounceTTL : Expiration of object to Announce mapping
+	AnnounceTTL time.Duration `json:"-"`
+	// RelayedTTL : Expiration of relayed activity ID for deduplication
+	RelayedTTL time.Duration `json:"-"`
 
-	RelayConfig    relayConfig    `json:"relayConfig,omitempty"`
-	LimitedDomains []string       `json:"limitedDomains,omitempty"`
-	BlockedDomains []string       `json:"blockedDomains,omitempty"`
-	Subscriptions  []Subscription `json:"subscriptions,omitempty"`
+	RelayConfig    relayConfig          `json:"relayConfig,omitempty"`
+	LimitedDomains []string             `json:"limitedDomains,omitempty"`
+	BlockedDomains []string             `json:"blockedDomains,omitempty"`
+	PausedDomains  []string             `json:"pausedDomains,omitempty"`
+	Subscriptions  []Subscription       `json:"subscriptions,omitempty"`
+	RateLimits     map[string]RateLimit `json:"rateLimits,omitempty"`
 }
 
 // NewState : Create new RelayState instance with redis client
@@ -64,6 +85,7 @@ func (config *RelayState) Load() {
 	config.RelayConfig.load(config.RedisClient)
 	var limitedDomains []string
 	var blockedDomains []string
+	var pausedDomains []string
 	var subscriptions []Subscription
 	domains, _ := config.RedisClient.HKeys("relay:config:limitedDomain").Result()
 	for _, domain := range domains {
@@ -73,6 +95,10 @@ func (config *RelayState) Load() {
 	for _, domain := range domains {
 		blockedDomains = append(blockedDomains, domain)
 	}
+	domains, _ = config.RedisClient.HKeys("relay:config:pausedDomain").Result()
+	for _, domain := range domains {
+		pausedDomains = append(pausedDomains, domain)
+	}
 	domains, _ = config.RedisClient.Keys("relay:subscription:*").Result()
 	for _, domain := range domains {
 		domainName := strings.Replace(domain, "relay:subscription:", "", 1)
@@ -85,11 +111,34 @@ func (config *RelayState) Load() {
 		if err != nil {
 			actorID = ""
 		}
-		subscriptions = append(subscriptions, Subscription{domainName, inboxURL, activityID, actorID})
+		subscription := Subscription{Domain: domainName, InboxURL: inboxURL, ActivityID: activityID, ActorID: actorID}
+		if limit, err := config.RedisClient.HGet(domain, "delivery_limit").Result(); err == nil {
+			var deliveryLimit DeliveryLimit
+			if json.Unmarshal([]byte(limit), &deliveryLimit) == nil {
+				subscription.DeliveryLimit = &deliveryLimit
+			}
+		}
+		if normalization, err := config.RedisClient.HGet(domain, "normalization").Result(); err == nil {
+			var relayNormalization Normalization
+			if json.Unmarshal([]byte(normalization), &relayNormalization) == nil {
+				subscription.Normalization = &relayNormalization
+			}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	rateLimits := map[string]RateLimit{}
+	limits, _ := config.RedisClient.HGetAll("relay:config:rateLimit").Result()
+	for domain, limit := range limits {
+		var rateLimit RateLimit
+		if json.Unmarshal([]byte(limit), &rateLimit) == nil {
+			rateLimits[domain] = rateLimit
+		}
 	}
 	config.LimitedDomains = limitedDomains
 	config.BlockedDomains = blockedDomains
+	config.PausedDomains = pausedDomains
 	config.Subscriptions = subscriptions
+	config.RateLimits = rateLimits
 }
 
 // SetConfig : Set relay configration
@@ -161,6 +210,69 @@ func (config *RelayState) SetLimitedDomain(domain string, value bool) {
 	config.refresh()
 }
 
+// SetPausedDomain : Set/Unset instance for paused domain, delivery to paused domain is deferred
+func (config *RelayState) SetPausedDomain(domain string, value bool) {
+	if value {
+		config.RedisClient.HSet("relay:config:pausedDomain", domain, "1").Result()
+	} else {
+		config.RedisClient.HDel("relay:config:pausedDomain", domain).Result()
+	}
+
+	config.refresh()
+}
+
+// SetRateLimit : Set/Unset inbound rate limit override for domain
+func (config *RelayState) SetRateLimit(domain string, limit RateLimit, value bool) {
+	if value {
+		jsonData, _ := json.Marshal(&limit)
+		config.RedisClient.HSet("relay:config:rateLimit", domain, jsonData).Result()
+	} else {
+		config.RedisClient.HDel("relay:config:rateLimit", domain).Result()
+	}
+
+	config.refresh()
+}
+
+// SetDeliveryLimit : Set/Unset outbound delivery limit override for subscriber
+func (config *RelayState) SetDeliveryLimit(domain string, limit DeliveryLimit, value bool) error {
+	exists, err := config.RedisClient.Exists("relay:subscription:" + domain).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return errors.New(domain + " is not subscribed")
+	}
+	if value {
+		jsonData, _ := json.Marshal(&limit)
+		config.RedisClient.HSet("relay:subscription:"+domain, "delivery_limit", jsonData).Result()
+	} else {
+		config.RedisClient.HDel("relay:subscription:"+domain, "delivery_limit").Result()
+	}
+
+	config.refresh()
+	return nil
+}
+
+// SetNormalization : Set/Unset normalization of relayed activities for subscriber
+func (config *RelayState) SetNormalization(domain string, normalization Normalization, value bool) error {
+	exists, err := config.RedisClient.Exists("relay:subscription:" + domain).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return errors.New(domain + " is not subscribed")
+	}
+	if value {
+		jsonData, _ := json.Marshal(&normalization)
+		config.RedisClient.HSet("relay:subscription:"+domain, "normalization", jsonData).Result()
+	} else {
+		config.RedisClient.HDel("relay:subscription:"+domain, "normalization").Result()
+	}
+
+	config.refresh()
+	return nil
+}
+
 func (config *RelayState) refresh() {
 	if config.notifiable {
 		config.RedisClient.Publish("relay_refresh", "Config refreshing request.")
@@ -175,6 +287,30 @@ type Subscription struct {
 	InboxURL   string `json:"inbox_url,omitempty"`
 	ActivityID string `json:"activity_id,omitempty"`
 	ActorID    string `json:"actor_id,omitempty"`
+
+	DeliveryLimit *DeliveryLimit `json:"delivery_limit,omitempty"`
+	Normalization *Normalization `json:"normalization,omitempty"`
+}
+
+// Normalization : Normalization of relayed activities for subscriber, zero limit means unlimited
+type Normalization struct {
+	SanitizeHTML     bool `json:"sanitize_html"`
+	MaxAttachments   int  `json:"max_attachments"`
+	MaxTags          int  `json:"max_tags"`
+	MaxExtensionSize int  `json:"max_extension_size"`
+}
+
+// DeliveryLimit : Outbound delivery limit, zero Concurrency or Rate means unlimited
+type DeliveryLimit struct {
+	Concurrency int     `json:"concurrency"`
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+}
+
+// RateLimit : Inbound rate limit, Rate is requests per second and zero Rate means unlimited
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
 }
 
 type relayConfig struct {
@@ -244,3 +244,102 @@ func TestLoadCompatiSubscription(t *testing.T) {
 
 	redisClient.FlushAll().Result()
 }
+
+func TestRateLimit(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.SetRateLimit("example.com", RateLimit{Rate: 5, Burst: 20}, true)
+	limit, ok := testState.RateLimits["example.com"]
+	if !ok || limit.Rate != 5 || limit.Burst != 20 {
+		t.Fatalf("Failed write config.")
+	}
+
+	testState.SetRateLimit("example.com", RateLimit{}, false)
+	if _, ok := testState.RateLimits["example.com"]; ok {
+		t.Fatalf("Failed write config.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestDeliveryLimit(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	err := testState.SetDeliveryLimit("example.com", DeliveryLimit{Concurrency: 2}, true)
+	if err == nil {
+		t.Fatalf("Failed - Delivery limit set for not subscribed domain.")
+	}
+
+	testState.AddSubscription(Subscription{
+		Domain:     "example.com",
+		InboxURL:   "https://example.com/inbox",
+		ActivityID: "https://example.com/UUID",
+		ActorID:    "https://example.com/user/example",
+	})
+	err = testState.SetDeliveryLimit("example.com", DeliveryLimit{Concurrency: 2, Rate: 1, Burst: 5}, true)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	limit := testState.SelectSubscription("example.com").DeliveryLimit
+	if limit == nil || limit.Concurrency != 2 || limit.Rate != 1 || limit.Burst != 5 {
+		t.Fatalf("Failed write config.")
+	}
+
+	testState.SetDeliveryLimit("example.com", DeliveryLimit{}, false)
+	if testState.SelectSubscription("example.com").DeliveryLimit != nil {
+		t.Fatalf("Failed write config.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestNormalization(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	err := testState.SetNormalization("example.com", Normalization{SanitizeHTML: true}, true)
+	if err == nil {
+		t.Fatalf("Failed - Normalization set for not subscribed domain.")
+	}
+
+	testState.AddSubscription(Subscription{
+		Domain:     "example.com",
+		InboxURL:   "https://example.com/inbox",
+		ActivityID: "https://example.com/UUID",
+		ActorID:    "https://example.com/user/example",
+	})
+	err = testState.SetNormalization("example.com", Normalization{SanitizeHTML: true, MaxAttachments: 4, MaxTags: 10, MaxExtensionSize: 1024}, true)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	normalization := testState.SelectSubscription("example.com").Normalization
+	if normalization == nil || !normalization.SanitizeHTML || normalization.MaxAttachments != 4 || normalization.MaxTags != 10 || normalization.MaxExtensionSize != 1024 {
+		t.Fatalf("Failed write config.")
+	}
+
+	testState.SetNormalization("example.com", Normalization{}, false)
+	if testState.SelectSubscription("example.com").Normalization != nil {
+		t.Fatalf("Failed write config.")
+	}
+
+	redisClient.FlushAll().Result()
+}
+
+func TestPausedDomain(t *testing.T) {
+	redisClient.FlushAll().Result()
+	testState := NewState(redisClient, false)
+
+	testState.SetPausedDomain("example.com", true)
+	if len(testState.PausedDomains) != 1 || testState.PausedDomains[0] != "example.com" {
+		t.Fatalf("Failed write config.")
+	}
+
+	testState.SetPausedDomain("example.com", false)
+	if len(testState.PausedDomains) != 0 {
+		t.Fatalf("Failed write config.")
+	}
+
+	redisClient.FlushAll().Result()
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenAddress : Remote address is private, loopback, link-local or metadata address
+var ErrForbiddenAddress = errors.New("Forbidden address")
+
+var forbiddenNetworks = parseNetworks(
+	"0.0.0.0/8",      // This network
+	"10.0.0.0/8",     // RFC1918
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"127.0.0.0/8",    // Loopback
+	"169.254.0.0/16", // Link-local, cloud metadata 169.254.169.254
+	"172.16.0.0/12",  // RFC1918
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // RFC1918
+	"198.18.0.0/15",  // Benchmarking
+	"224.0.0.0/4",    // Multicast
+	"240.0.0.0/4",    // Reserved, broadcast
+	"::/128",         // Unspecified
+	"::1/128",        // Loopback
+	"64:ff9b::/96",   // NAT64 may reach private IPv4
+	"fc00::/7",       // Unique local, cloud metadata fd00:ec2::254
+	"fe80::/10",      // Link-local
+	"ff00::/8",       // Multicast
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Guard : Reject dial to forbidden address after DNS resolution, AllowList takes CIDR or hostname
+type Guard struct {
+	allowedNetworks []*net.IPNet
+	allowedHosts    map[string]bool
+}
+
+// NewGuard : Create Guard with allow-list of CIDR, IP address or hostname
+func NewGuard(allowList []string) (*Guard, error) {
+	guard := &Guard{allowedHosts: map[string]bool{}}
+	for _, allowed := range allowList {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			guard.allowedNetworks = append(guard.allowedNetworks, network)
+			continue
+		}
+		if ip := net.ParseIP(allowed); ip != nil {
+			guard.allowedNetworks = append(guard.allowedNetworks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		if strings.ContainsAny(allowed, "/:") {
+			return nil, errors.New("Invalid allow-list entry [" + allowed + "] given")
+		}
+		guard.allowedHosts[strings.ToLower(allowed)] = true
+	}
+	return guard, nil
+}
+
+// Permitted : Check IP address is public or allowed
+func (guard *Guard) Permitted(ip net.IP) bool {
+	for _, network := range guard.allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// control : net.Dialer Control to check resolved address just before connect
+func (guard *Guard) control(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !guard.Permitted(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// DialContext : Wrap dialer, host in allow-list is dialed without check
+func (guard *Guard) DialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = guard.control
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && guard.allowedHosts[strings.ToLower(host)] {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGuardPermitted(t *testing.T) {
+	guard, _ := NewGuard(nil)
+	forbidden := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1", "::ffff:10.0.0.1"}
+	for _, address := range forbidden {
+		if guard.Permitted(net.ParseIP(address)) {
+			t.Fatalf("Failed - Forbidden address %s permitted.", address)
+		}
+	}
+	permitted := []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888"}
+	for _, address := range permitted {
+		if !guard.Permitted(net.ParseIP(address)) {
+			t.Fatalf("Failed - Public address %s forbidden.", address)
+		}
+	}
+}
+
+func TestGuardAllowList(t *testing.T) {
+	guard, err := NewGuard([]string{"10.0.0.0/24", "192.168.1.1", "internal.example.com"})
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if !guard.Permitted(net.ParseIP("10.0.0.5")) || !guard.Permitted(net.ParseIP("192.168.1.1")) {
+		t.Fatalf("Failed - Allowed address forbidden.")
+	}
+	if guard.Permitted(net.ParseIP("10.0.1.5")) || guard.Permitted(net.ParseIP("192.168.1.2")) {
+		t.Fatalf("Failed - Not allowed address permitted.")
+	}
+	if !guard.allowedHosts["internal.example.com"] {
+		t.Fatalf("Failed - Allowed host not registered.")
+	}
+	_, err = NewGuard([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Fatalf("Failed - Invalid allow-list entry accepted.")
+	}
+}
+
+func TestClientRejectLoopback(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Failed - Request reached loopback server.")
+	}))
+	defer s.Close()
+
+	client, _ := NewClient(Config{})
+	_, err := client.Get(s.URL)
+	if err == nil || !strings.Contains(err.Error(), ErrForbiddenAddress.Error()) {
+		t.Fatalf("Failed - Loopback address not rejected.")
+	}
+}
+
+func TestClientRejectRedirectToLoopback(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Failed - Redirect reached loopback server.")
+	}))
+	defer internal.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, 302)
+	}))
+	defer s.Close()
+	sURL, _ := url.Parse(s.URL)
+
+	client, _ := NewClient(Config{AllowList: []string{"localhost"}})
+	_, err := client.Get("http://localhost:" + sURL.Port())
+	if err == nil || !strings.Contains(err.Error(), ErrForbiddenAddress.Error()) {
+		t.Fatalf("Failed - Redirect to loopback address not rejected.")
+	}
+}
+
+func TestClientAllowList(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+	sURL, _ := url.Parse(s.URL)
+
+	for _, allowed := range []string{"127.0.0.0/8", "localhost"} {
+		client, err := NewClient(Config{AllowList: []string{allowed}})
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		resp, err := client.Get("http://localhost:" + sURL.Port())
+		if err != nil {
+			t.Fatalf("Failed - Allowed %s rejected : %s", allowed, err.Error())
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigKeys : Keys of outbound HTTP settings in config.yaml and environment variables
+var ConfigKeys = []string{
+	"http_timeout",
+	"http_dial_timeout",
+	"http_tls_handshake_timeout",
+	"http_response_header_timeout",
+	"http_idle_conn_timeout",
+	"http_max_idle_conns_per_host",
+	"http_max_conns_per_host",
+	"http_disable_http2",
+	"http_tls_min_version",
+	"http_proxy",
+	"http_allow_private",
+	"http_allowlist",
+}
+
+// Config : Outbound HTTP settings, zero value of each field uses default
+type Config struct {
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	DisableHTTP2          bool
+	TLSMinVersion         string
+	// Proxy : http, https or socks5 proxy URL, empty uses HTTP_PROXY and HTTPS_PROXY environment variables
+	Proxy string
+	// AllowPrivate : Disable Guard, private and loopback address can be requested
+	AllowPrivate bool
+	// AllowList : CIDR, IP address or hostname requested bypassing Guard
+	AllowList []string
+}
+
+// LoadConfig : Load Config from viper by ConfigKeys
+func LoadConfig() Config {
+	return Config{
+		Timeout:               viper.GetDuration("http_timeout"),
+		DialTimeout:           viper.GetDuration("http_dial_timeout"),
+		TLSHandshakeTimeout:   viper.GetDuration("http_tls_handshake_timeout"),
+		ResponseHeaderTimeout: viper.GetDuration("http_response_header_timeout"),
+		IdleConnTimeout:       viper.GetDuration("http_idle_conn_timeout"),
+		MaxIdleConnsPerHost:   viper.GetInt("http_max_idle_conns_per_host"),
+		MaxConnsPerHost:       viper.GetInt("http_max_conns_per_host"),
+		DisableHTTP2:          viper.GetBool("http_disable_http2"),
+		TLSMinVersion:         viper.GetString("http_tls_min_version"),
+		Proxy:                 viper.GetString("http_proxy"),
+		AllowPrivate:          viper.GetBool("http_allow_private"),
+		AllowList:             viper.GetStringSlice("http_allowlist"),
+	}
+}
+
+func orDefault(value time.Duration, def time.Duration) time.Duration {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New("Invalid TLS version [" + version + "] given")
+}
+
+// NewTransport : Create pooled transport by config
+func NewTransport(config Config) (*http.Transport, error) {
+	allowList := config.AllowList
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errors.New("Invalid proxy scheme [" + proxyURL.Scheme + "] given")
+		}
+		proxy = http.ProxyURL(proxyURL)
+		// Proxy itself is usually in private network, remote address is resolved by proxy
+		allowList = append([]string{proxyURL.Hostname()}, allowList...)
+	}
+	minVersion, err := tlsVersion(config.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	maxIdleConnsPerHost := config.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = 8
+	}
+	dialer := &net.Dialer{
+		Timeout:   orDefault(config.DialTimeout, 5*time.Second),
+		KeepAlive: 30 * time.Second,
+	}
+	dialContext := dialer.DialContext
+	if !config.AllowPrivate {
+		guard, err := NewGuard(allowList)
+		if err != nil {
+			return nil, err
+		}
+		dialContext = guard.DialContext(dialer)
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialContext,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+		TLSClientConfig:       &tls.Config{MinVersion: minVersion},
+		TLSHandshakeTimeout:   orDefault(config.TLSHandshakeTimeout, 5*time.Second),
+		ResponseHeaderTimeout: orDefault(config.ResponseHeaderTimeout, 10*time.Second),
+		IdleConnTimeout:       orDefault(config.IdleConnTimeout, 90*time.Second),
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+	}
+	if config.DisableHTTP2 {
+		// Non-nil empty map disables HTTP/2 even if server supports it
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, nil
+}
+
+// NewClient : Create client sharing transport by config
+func NewClient(config Config) (*http.Client, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   orDefault(config.Timeout, 10*time.Second),
+	}, nil
+}
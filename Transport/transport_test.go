@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func trustServer(client *http.Client, s *httptest.Server) {
+	client.Transport.(*http.Transport).TLSClientConfig.RootCAs = s.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+}
+
+func TestNewClientHTTP2(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	s.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	s.StartTLS()
+	defer s.Close()
+
+	client, err := NewClient(Config{AllowPrivate: true})
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	trustServer(client, s)
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("Failed - HTTP/2 not negotiated.")
+	}
+
+	client, _ = NewClient(Config{DisableHTTP2: true, AllowPrivate: true})
+	trustServer(client, s)
+	resp, err = client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("Failed - HTTP/2 not disabled.")
+	}
+}
+
+func TestNewClientProxy(t *testing.T) {
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(204)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(Config{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	resp, err := client.Get("http://remote.example.com/inbox")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	resp.Body.Close()
+	if proxied != "http://remote.example.com/inbox" {
+		t.Fatalf("Failed - Request not sent via proxy.")
+	}
+}
+
+func TestNewClientInvalidConfig(t *testing.T) {
+	_, err := NewClient(Config{Proxy: "ftp://proxy.example.com"})
+	if err == nil {
+		t.Fatalf("Failed - Invalid proxy scheme accepted.")
+	}
+	_, err = NewClient(Config{TLSMinVersion: "2.0"})
+	if err == nil {
+		t.Fatalf("Failed - Invalid TLS version accepted.")
+	}
+	_, err = NewClient(Config{Proxy: "socks5://127.0.0.1:1080"})
+	if err != nil {
+		t.Fatalf("Failed - SOCKS proxy not accepted.")
+	}
+}
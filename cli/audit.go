@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func auditCmdInit() *cobra.Command {
+	var audit = &cobra.Command{
+		Use:   "audit",
+		Short: "Show audit log",
+		Long:  "Show or export audit log of follow, kick and moderation actions.",
+	}
+
+	var auditList = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List audit log",
+		Long:  "List audit log which filtered by domain and time range.",
+		RunE:  listAudit,
+	}
+	auditList.Flags().StringP("domain", "d", "", "Filter by target domain")
+	auditList.Flags().String("since", "", "Filter entries after given time (RFC3339, 2006-01-02 or duration like 24h)")
+	auditList.Flags().String("until", "", "Filter entries before given time (RFC3339, 2006-01-02 or duration like 24h)")
+	audit.AddCommand(auditList)
+
+	var auditExport = &cobra.Command{
+		Use:   "export [flags]",
+		Short: "Export audit log",
+		Long:  "Export audit log by JSONL format.",
+		RunE:  exportAudit,
+	}
+	auditExport.Flags().StringP("domain", "d", "", "Filter by target domain")
+	auditExport.Flags().String("since", "", "Filter entries after given time (RFC3339, 2006-01-02 or duration like 24h)")
+	auditExport.Flags().String("until", "", "Filter entries before given time (RFC3339, 2006-01-02 or duration like 24h)")
+	audit.AddCommand(auditExport)
+
+	return audit
+}
+
+// parseAuditTime : Parse absolute time or duration before now
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, errors.New("Invalid time [" + value + "] given")
+}
+
+func filteredAudit(cmd *cobra.Command) ([]state.AuditEntry, error) {
+	since, err := parseAuditTime(cmd.Flag("since").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseAuditTime(cmd.Flag("until").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	return relayState.ListAudit(cmd.Flag("domain").Value.String(), since, until)
+}
+
+func listAudit(cmd *cobra.Command, args []string) error {
+	entries, err := filteredAudit(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.Println(" - Audit log :")
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s [%s] %s", entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Actor, entry.Action)
+		if entry.Domain != "" {
+			line += " " + entry.Domain
+		}
+		if entry.Reason != "" {
+			line += " : " + entry.Reason
+		}
+		cmd.Println(line)
+	}
+	cmd.Println(fmt.Sprintf("Total : %d", len(entries)))
+
+	return nil
+}
+
+func exportAudit(cmd *cobra.Command, args []string) error {
+	entries, err := filteredAudit(cmd)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		jsonData, err := json.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(jsonData))
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func TestListAudit(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"domain", "set", "-t", "blocked", "-r", "spam", "blocked.example.jp"})
+	app.Execute()
+	app.SetArgs([]string{"domain", "set", "-t", "limited", "limited.example.jp"})
+	app.Execute()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"audit", "list", "-d", "blocked.example.jp"})
+	app.Execute()
+
+	lines := strings.Split(buffer.String(), "\n")
+	if len(lines) != 4 || lines[0] != " - Audit log :" || !strings.HasSuffix(lines[1], " block blocked.example.jp : spam") || lines[2] != "Total : 1" {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestListAuditInvalidTime(t *testing.T) {
+	app := buildNewCmd()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"audit", "list", "--since", "yesterday"})
+	err := app.Execute()
+	if err == nil {
+		t.Fatalf("Invalid time accepted.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestExportAudit(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"config", "import", "--json", "../misc/exampleConfig.json"})
+	app.Execute()
+	app.SetArgs([]string{"domain", "unfollow", "-r", "inactive", "subscription.example.jp"})
+	app.Execute()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"audit", "export", "--since", "1h"})
+	app.Execute()
+
+	var entries []state.AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var entry state.AuditEntry
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("Invalid JSONL Response.")
+		}
+		entries = append(entries, entry)
+	}
+	last := entries[len(entries)-1]
+	if last.Action != state.AuditKick || last.Domain != "subscription.example.jp" || last.Reason != "inactive" {
+		t.Fatalf("Kick not recorded.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"net/url"
+	"os/user"
 
 	"github.com/RichardKnop/machinery/v1"
 	"github.com/RichardKnop/machinery/v1/config"
@@ -13,6 +14,7 @@ import (
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
 	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
 	state "github.com/yukimochi/Activity-Relay/State"
+	transport "github.com/yukimochi/Activity-Relay/Transport"
 )
 
 var (
@@ -27,6 +29,9 @@ var (
 	machineryServer *machinery.Server
 )
 
+// Queue of delivery jobs in machinery
+const machineryQueue = "relay"
+
 func initConfig() {
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
@@ -38,6 +43,23 @@ func initConfig() {
 		viper.BindEnv("relay_bind")
 		viper.BindEnv("relay_domain")
 		viper.BindEnv("relay_servicename")
+		viper.BindEnv("allow_max_user")
+		viper.BindEnv("allow_min_user")
+		viper.BindEnv("kick_max_user")
+		viper.BindEnv("kick_min_user")
+		viper.BindEnv("policy_file")
+		viper.BindEnv("kick_grace_checks")
+		viper.BindEnv("kick_grace_period")
+		viper.BindEnv("kick_warning")
+		viper.BindEnv("nodeinfo_cache_ttl")
+		viper.BindEnv("outbox_size")
+		viper.BindEnv("activity_ttl")
+		viper.BindEnv("audit_size")
+		viper.BindEnv("dlq_size")
+		viper.BindEnv("dlq_ttl")
+		for _, key := range transport.ConfigKeys {
+			viper.BindEnv(key)
+		}
 	} else {
 		Actor.Summary = viper.GetString("relay_summary")
 		Actor.Icon = activitypub.Image{URL: viper.GetString("relay_icon")}
@@ -59,9 +81,14 @@ func initConfig() {
 	}
 	redisClient := redis.NewClient(redisOption)
 	relayState = state.NewState(redisClient, false)
+	relayState.ActivityLimit = viper.GetInt("outbox_size")
+	relayState.ActivityTTL = viper.GetDuration("activity_ttl")
+	relayState.AuditLogSize = viper.GetInt("audit_size")
+	relayState.DeadLetterLimit = viper.GetInt("dlq_size")
+	relayState.DeadLetterTTL = viper.GetDuration("dlq_ttl")
 	var machineryConfig = &config.Config{
 		Broker:          viper.GetString("redis_url"),
-		DefaultQueue:    "relay",
+		DefaultQueue:    machineryQueue,
 		ResultBackend:   viper.GetString("redis_url"),
 		ResultsExpireIn: 5,
 	}
@@ -73,11 +100,25 @@ func initConfig() {
 	Actor.GenerateSelfKey(hostname, &hostkey.PublicKey)
 }
 
+// auditActor : Actor name recorded in audit log
+func auditActor() string {
+	current, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return "cli:" + current.Username
+}
+
 func buildNewCmd() *cobra.Command {
 	var app = &cobra.Command{}
 	app.AddCommand(domainCmdInit())
 	app.AddCommand(followCmdInit())
 	app.AddCommand(configCmdInit())
+	app.AddCommand(auditCmdInit())
+	app.AddCommand(spyCmdInit())
+	app.AddCommand(queueCmdInit())
+	app.AddCommand(migrationCmdInit())
+	app.AddCommand(reportsCmdInit())
 	return app
 }
 
@@ -75,25 +75,31 @@ func configEnable(cmd *cobra.Command, args []string) error {
 		case "service-block":
 			if disable {
 				relayState.SetConfig(BlockService, false)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" disabled")
 				cmd.Println("Blocking for service-type actor is Disabled.")
 			} else {
 				relayState.SetConfig(BlockService, true)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" enabled")
 				cmd.Println("Blocking for service-type actor is Enabled.")
 			}
 		case "manually-accept":
 			if disable {
 				relayState.SetConfig(ManuallyAccept, false)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" disabled")
 				cmd.Println("Manually accept follow-request is Disabled.")
 			} else {
 				relayState.SetConfig(ManuallyAccept, true)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" enabled")
 				cmd.Println("Manually accept follow-request is Enabled.")
 			}
 		case "create-as-announce":
 			if disable {
 				relayState.SetConfig(CreateAsAnnounce, false)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" disabled")
 				cmd.Println("Announce activity instead of relay create activity is Disabled.")
 			} else {
 				relayState.SetConfig(CreateAsAnnounce, true)
+				relayState.AddAudit(auditActor(), state.AuditConfig, "", config+" enabled")
 				cmd.Println("Announce activity instead of relay create activity is Enabled.")
 			}
 		default:
@@ -132,6 +138,7 @@ func importConfig(cmd *cobra.Command, args []string) {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
+	relayState.AddAudit(auditActor(), state.AuditConfig, "", "Import from "+cmd.Flag("json").Value.String())
 
 	if data.RelayConfig.BlockService {
 		relayState.SetConfig(BlockService, true)
@@ -153,6 +160,14 @@ func importConfig(cmd *cobra.Command, args []string) {
 		relayState.SetBlockedDomain(BlockedDomain, true)
 		cmd.Println("Set [" + BlockedDomain + "] as blocked domain")
 	}
+	for _, PausedDomain := range data.PausedDomains {
+		relayState.SetPausedDomain(PausedDomain, true)
+		cmd.Println("Set [" + PausedDomain + "] as paused domain")
+	}
+	for domain, limit := range data.RateLimits {
+		relayState.SetRateLimit(domain, limit, true)
+		cmd.Println("Set rate limit for [" + domain + "]")
+	}
 	for _, Subscription := range data.Subscriptions {
 		relayState.AddSubscription(state.Subscription{
 			Domain:     Subscription.Domain,
@@ -160,6 +175,12 @@ func importConfig(cmd *cobra.Command, args []string) {
 			ActivityID: Subscription.ActivityID,
 			ActorID:    Subscription.ActorID,
 		})
+		if Subscription.DeliveryLimit != nil {
+			relayState.SetDeliveryLimit(Subscription.Domain, *Subscription.DeliveryLimit, true)
+		}
+		if Subscription.Normalization != nil {
+			relayState.SetNormalization(Subscription.Domain, *Subscription.Normalization, true)
+		}
 		cmd.Println("Regist [" + Subscription.Domain + "] as subscriber")
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
@@ -22,7 +23,7 @@ func domainCmdInit() *cobra.Command {
 		Long:  "List domain which filtered given type.",
 		RunE:  listDomains,
 	}
-	domainList.Flags().StringP("type", "t", "subscriber", "domain type [subscriber,limited,blocked]")
+	domainList.Flags().StringP("type", "t", "subscriber", "domain type [subscriber,limited,blocked,ratelimited]")
 	domain.AddCommand(domainList)
 
 	var domainSet = &cobra.Command{
@@ -35,14 +36,58 @@ func domainCmdInit() *cobra.Command {
 	domainSet.Flags().StringP("type", "t", "", "Apply domain type [limited,blocked]")
 	domainSet.MarkFlagRequired("type")
 	domainSet.Flags().BoolP("undo", "u", false, "Unset domain as limited or blocked")
+	domainSet.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
 	domain.AddCommand(domainSet)
 
+	var domainRateLimit = &cobra.Command{
+		Use:   "ratelimit [flags]",
+		Short: "Set or unset inbound rate limit for domain",
+		Long:  "Set or unset inbound rate limit for domain, overriding default rate limit.\nRate 0 means unlimited.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  setDomainRateLimit,
+	}
+	domainRateLimit.Flags().Float64("rate", 0, "Accepted activities per second")
+	domainRateLimit.Flags().Int("burst", 1, "Accepted activities in burst")
+	domainRateLimit.Flags().BoolP("undo", "u", false, "Unset rate limit and use default rate limit")
+	domainRateLimit.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	domain.AddCommand(domainRateLimit)
+
+	var domainDeliveryLimit = &cobra.Command{
+		Use:   "deliverylimit [flags]",
+		Short: "Set or unset outbound delivery limit for subscriber",
+		Long:  "Set or unset outbound delivery limit for subscriber, overriding default delivery limit of worker.\nConcurrency 0 and rate 0 mean unlimited.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  setDomainDeliveryLimit,
+	}
+	domainDeliveryLimit.Flags().Int("concurrency", 0, "Concurrent deliveries to subscriber")
+	domainDeliveryLimit.Flags().Float64("rate", 0, "Deliveries per second")
+	domainDeliveryLimit.Flags().Int("burst", 1, "Deliveries in burst")
+	domainDeliveryLimit.Flags().BoolP("undo", "u", false, "Unset delivery limit and use default delivery limit")
+	domainDeliveryLimit.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	domain.AddCommand(domainDeliveryLimit)
+
+	var domainNormalize = &cobra.Command{
+		Use:   "normalize [flags]",
+		Short: "Set or unset normalization of relayed activities for subscriber",
+		Long:  "Set or unset normalization of relayed activities for subscriber.\nNormalized activity has no bto, bcc and Linked Data Signature, and is delivered under relay's signature.\nActivity exceeding max attachments or max tags is not relayed to subscriber. Limit 0 means unlimited.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  setDomainNormalization,
+	}
+	domainNormalize.Flags().Bool("sanitize-html", false, "Reduce HTML in content and summary to safe subset")
+	domainNormalize.Flags().Int("max-attachments", 0, "Max attachments of relayed object")
+	domainNormalize.Flags().Int("max-tags", 0, "Max tags of relayed object")
+	domainNormalize.Flags().Int("max-extension-size", 0, "Max size in bytes of extension property, larger one is dropped")
+	domainNormalize.Flags().BoolP("undo", "u", false, "Unset normalization and relay activities as received")
+	domainNormalize.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	domain.AddCommand(domainNormalize)
+
 	var domainUnfollow = &cobra.Command{
 		Use:   "unfollow [flags]",
 		Short: "Send Unfollow request for given domains",
 		Long:  "Send unfollow request for given domains.",
 		RunE:  unfollowDomains,
 	}
+	domainUnfollow.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
 	domain.AddCommand(domainUnfollow)
 
 	return domain
@@ -52,13 +97,14 @@ func createUnfollowRequestResponse(subscription state.Subscription) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:      subscription.ActivityID,
-		Actor:   subscription.ActorID,
+		Actor:   activitypub.Link(subscription.ActorID),
 		Type:    "Follow",
-		Object:  "https://www.w3.org/ns/activitystreams#Public",
+		Object:  activitypub.LinkTo("https://www.w3.org/ns/activitystreams#Public"),
 	}
 
 	resp := activity.GenerateResponse(hostname, "Reject")
 	jsonData, _ := json.Marshal(&resp)
+	relayState.AddActivity(resp.ID, jsonData, false)
 	pushRegistorJob(subscription.InboxURL, jsonData)
 
 	return nil
@@ -73,6 +119,19 @@ func listDomains(cmd *cobra.Command, args []string) error {
 	case "blocked":
 		cmd.Println(" - Blocked domain :")
 		domains = relayState.BlockedDomains
+	case "ratelimited":
+		cmd.Println(" - Rate limited domain :")
+		limited, _ := relayState.RedisClient.HGetAll("relay:statistics:ratelimit").Result()
+		for domain := range relayState.RateLimits {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			limit := relayState.RateLimits[domain]
+			cmd.Println(fmt.Sprintf("%s : rate %g/s, burst %d, limited %s times", domain, limit.Rate, limit.Burst, orZero(limited[domain])))
+		}
+		cmd.Println(fmt.Sprintf("Total : %d", len(domains)))
+		return nil
 	default:
 		cmd.Println(" - Subscriber domain :")
 		temp := relayState.Subscriptions
@@ -90,13 +149,16 @@ func listDomains(cmd *cobra.Command, args []string) error {
 
 func setDomainType(cmd *cobra.Command, args []string) error {
 	undo := cmd.Flag("undo").Value.String() == "true"
+	reason := cmd.Flag("reason").Value.String()
 	switch cmd.Flag("type").Value.String() {
 	case "limited":
 		for _, domain := range args {
 			relayState.SetLimitedDomain(domain, !undo)
 			if undo {
+				relayState.AddAudit(auditActor(), state.AuditUnlimit, domain, reason)
 				cmd.Println("Unset [" + domain + "] as limited domain")
 			} else {
+				relayState.AddAudit(auditActor(), state.AuditLimit, domain, reason)
 				cmd.Println("Set [" + domain + "] as limited domain")
 			}
 		}
@@ -104,8 +166,10 @@ func setDomainType(cmd *cobra.Command, args []string) error {
 		for _, domain := range args {
 			relayState.SetBlockedDomain(domain, !undo)
 			if undo {
+				relayState.AddAudit(auditActor(), state.AuditUnblock, domain, reason)
 				cmd.Println("Unset [" + domain + "] as blocked domain")
 			} else {
+				relayState.AddAudit(auditActor(), state.AuditBlock, domain, reason)
 				cmd.Println("Set [" + domain + "] as blocked domain")
 			}
 		}
@@ -116,6 +180,97 @@ func setDomainType(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func orZero(count string) string {
+	if count == "" {
+		return "0"
+	}
+	return count
+}
+
+func setDomainRateLimit(cmd *cobra.Command, args []string) error {
+	undo := cmd.Flag("undo").Value.String() == "true"
+	reason := cmd.Flag("reason").Value.String()
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	burst, _ := cmd.Flags().GetInt("burst")
+	if !undo && (rate < 0 || burst < 1) {
+		cmd.Println("Invalid rate or burst given")
+		return nil
+	}
+	limit := state.RateLimit{Rate: rate, Burst: burst}
+	for _, domain := range args {
+		relayState.SetRateLimit(domain, limit, !undo)
+		if undo {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Unset rate limit : "+reason)
+			cmd.Println("Unset rate limit for [" + domain + "]")
+		} else {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, fmt.Sprintf("Set rate limit %g/s burst %d : %s", rate, burst, reason))
+			cmd.Println(fmt.Sprintf("Set rate limit for [%s] to %g/s, burst %d", domain, rate, burst))
+		}
+	}
+
+	return nil
+}
+
+func setDomainDeliveryLimit(cmd *cobra.Command, args []string) error {
+	undo := cmd.Flag("undo").Value.String() == "true"
+	reason := cmd.Flag("reason").Value.String()
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	burst, _ := cmd.Flags().GetInt("burst")
+	if !undo && (concurrency < 0 || rate < 0 || burst < 1) {
+		cmd.Println("Invalid concurrency, rate or burst given")
+		return nil
+	}
+	limit := state.DeliveryLimit{Concurrency: concurrency, Rate: rate, Burst: burst}
+	for _, domain := range args {
+		err := relayState.SetDeliveryLimit(domain, limit, !undo)
+		if err != nil {
+			cmd.Println("Invalid domain [" + domain + "] given")
+			continue
+		}
+		if undo {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Unset delivery limit : "+reason)
+			cmd.Println("Unset delivery limit for [" + domain + "]")
+		} else {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, fmt.Sprintf("Set delivery limit %d concurrency %g/s burst %d : %s", concurrency, rate, burst, reason))
+			cmd.Println(fmt.Sprintf("Set delivery limit for [%s] to %d concurrency, %g/s, burst %d", domain, concurrency, rate, burst))
+		}
+	}
+
+	return nil
+}
+
+func setDomainNormalization(cmd *cobra.Command, args []string) error {
+	undo := cmd.Flag("undo").Value.String() == "true"
+	reason := cmd.Flag("reason").Value.String()
+	sanitizeHTML, _ := cmd.Flags().GetBool("sanitize-html")
+	maxAttachments, _ := cmd.Flags().GetInt("max-attachments")
+	maxTags, _ := cmd.Flags().GetInt("max-tags")
+	maxExtensionSize, _ := cmd.Flags().GetInt("max-extension-size")
+	if !undo && (maxAttachments < 0 || maxTags < 0 || maxExtensionSize < 0) {
+		cmd.Println("Invalid max attachments, max tags or max extension size given")
+		return nil
+	}
+	normalization := state.Normalization{SanitizeHTML: sanitizeHTML, MaxAttachments: maxAttachments, MaxTags: maxTags, MaxExtensionSize: maxExtensionSize}
+	summary := fmt.Sprintf("sanitize html %t, max attachments %d, max tags %d, max extension size %d", sanitizeHTML, maxAttachments, maxTags, maxExtensionSize)
+	for _, domain := range args {
+		err := relayState.SetNormalization(domain, normalization, !undo)
+		if err != nil {
+			cmd.Println("Invalid domain [" + domain + "] given")
+			continue
+		}
+		if undo {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Unset normalization : "+reason)
+			cmd.Println("Unset normalization for [" + domain + "]")
+		} else {
+			relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Set normalization "+summary+" : "+reason)
+			cmd.Println("Set normalization for [" + domain + "] to " + summary)
+		}
+	}
+
+	return nil
+}
+
 func unfollowDomains(cmd *cobra.Command, args []string) error {
 	subscriptions := relayState.Subscriptions
 	for _, domain := range args {
@@ -123,6 +278,7 @@ func unfollowDomains(cmd *cobra.Command, args []string) error {
 			subscription := *relayState.SelectSubscription(domain)
 			createUnfollowRequestResponse(subscription)
 			relayState.DelSubscription(subscription.Domain)
+			relayState.AddAudit(auditActor(), state.AuditKick, subscription.Domain, cmd.Flag("reason").Value.String())
 			cmd.Println("Unfollow [" + subscription.Domain + "]")
 			break
 		} else {
@@ -236,3 +236,119 @@ func TestInvalidUnfollowDomain(t *testing.T) {
 	relayState.RedisClient.FlushAll().Result()
 	relayState.Load()
 }
+
+func TestSetDomainRateLimit(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"domain", "ratelimit", "--rate", "0.5", "--burst", "10", "testdomain.example.jp"})
+	app.Execute()
+
+	limit, ok := relayState.RateLimits["testdomain.example.jp"]
+	if !ok || limit.Rate != 0.5 || limit.Burst != 10 {
+		t.Fatalf("Not set rate limit")
+	}
+
+	app.SetArgs([]string{"domain", "ratelimit", "-u", "testdomain.example.jp"})
+	app.Execute()
+
+	if _, ok := relayState.RateLimits["testdomain.example.jp"]; ok {
+		t.Fatalf("Not unset rate limit")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestListDomainRateLimited(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"domain", "ratelimit", "--rate", "2", "--burst", "5", "testdomain.example.jp"})
+	app.Execute()
+	relayState.RedisClient.HIncrBy("relay:statistics:ratelimit", "testdomain.example.jp", 3)
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"domain", "list", "-t", "ratelimited"})
+	app.Execute()
+
+	output := buffer.String()
+	valid := ` - Rate limited domain :
+testdomain.example.jp : rate 2/s, burst 5, limited 3 times
+Total : 1
+`
+	if output != valid {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestSetDomainDeliveryLimit(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"config", "import", "--json", "../misc/exampleConfig.json"})
+	app.Execute()
+
+	app.SetArgs([]string{"domain", "deliverylimit", "--concurrency", "4", "--rate", "2", "--burst", "8", "subscription.example.jp"})
+	app.Execute()
+
+	limit := relayState.SelectSubscription("subscription.example.jp").DeliveryLimit
+	if limit == nil || limit.Concurrency != 4 || limit.Rate != 2 || limit.Burst != 8 {
+		t.Fatalf("Not set delivery limit")
+	}
+
+	app.SetArgs([]string{"domain", "deliverylimit", "-u", "subscription.example.jp"})
+	app.Execute()
+
+	if relayState.SelectSubscription("subscription.example.jp").DeliveryLimit != nil {
+		t.Fatalf("Not unset delivery limit")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestSetDomainNormalization(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"config", "import", "--json", "../misc/exampleConfig.json"})
+	app.Execute()
+
+	app.SetArgs([]string{"domain", "normalize", "--sanitize-html", "--max-attachments", "4", "--max-tags", "10", "subscription.example.jp"})
+	app.Execute()
+
+	normalization := relayState.SelectSubscription("subscription.example.jp").Normalization
+	if normalization == nil || !normalization.SanitizeHTML || normalization.MaxAttachments != 4 || normalization.MaxTags != 10 || normalization.MaxExtensionSize != 0 {
+		t.Fatalf("Not set normalization")
+	}
+
+	app.SetArgs([]string{"domain", "normalize", "-u", "subscription.example.jp"})
+	app.Execute()
+
+	if relayState.SelectSubscription("subscription.example.jp").Normalization != nil {
+		t.Fatalf("Not unset normalization")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestSetDomainDeliveryLimitInvalid(t *testing.T) {
+	app := buildNewCmd()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"domain", "deliverylimit", "--concurrency", "4", "notsubscribed.example.jp"})
+	app.Execute()
+
+	output := buffer.String()
+	if strings.Split(output, "\n")[0] != "Invalid domain [notsubscribed.example.jp] given" {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
@@ -10,6 +10,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	queue "github.com/yukimochi/Activity-Relay/Queue"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
 
@@ -35,6 +36,7 @@ func followCmdInit() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		RunE:  acceptFollow,
 	}
+	followAccept.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
 	follow.AddCommand(followAccept)
 
 	var followReject = &cobra.Command{
@@ -44,6 +46,7 @@ func followCmdInit() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		RunE:  rejectFollow,
 	}
+	followReject.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
 	follow.AddCommand(followReject)
 
 	var updateActor = &cobra.Command{
@@ -60,7 +63,8 @@ func followCmdInit() *cobra.Command {
 func pushRegistorJob(inboxURL string, body []byte) {
 	job := &tasks.Signature{
 		Name:       "registor",
-		RetryCount: 25,
+		RetryCount: queue.RegistorRetryCount,
+		Headers:    queue.NewHeaders(),
 		Args: []tasks.Arg{
 			{
 				Name:  "inboxURL",
@@ -88,9 +92,9 @@ func createFollowRequestResponse(domain string, response string) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:      data["activity_id"],
-		Actor:   data["actor"],
+		Actor:   activitypub.Link(data["actor"]),
 		Type:    data["type"],
-		Object:  data["object"],
+		Object:  activitypub.LinkTo(data["object"]),
 	}
 
 	resp := activity.GenerateResponse(hostname, response)
@@ -98,6 +102,7 @@ func createFollowRequestResponse(domain string, response string) error {
 	if err != nil {
 		return err
 	}
+	relayState.AddActivity(resp.ID, jsonData, false)
 	pushRegistorJob(data["inbox_url"], jsonData)
 	relayState.RedisClient.Del("relay:pending:" + domain)
 	if response == "Accept" {
@@ -112,21 +117,24 @@ func createFollowRequestResponse(domain string, response string) error {
 	return nil
 }
 
-func createUpdateActorActivity(subscription state.Subscription) error {
+func createUpdateActorActivity(subscriptions []state.Subscription) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams"},
 		ID:      hostname.String() + "/activities/" + uuid.NewV4().String(),
-		Actor:   hostname.String() + "/actor",
+		Actor:   activitypub.Link(hostname.String() + "/actor"),
 		Type:    "Update",
 		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
-		Object:  Actor,
+		Object:  activitypub.Embed(&Actor),
 	}
 
 	jsonData, err := json.Marshal(&activity)
 	if err != nil {
 		return err
 	}
-	pushRegistorJob(subscription.InboxURL, jsonData)
+	relayState.AddActivity(activity.ID, jsonData, true)
+	for _, subscription := range subscriptions {
+		pushRegistorJob(subscription.InboxURL, jsonData)
+	}
 
 	return nil
 }
@@ -164,6 +172,7 @@ func acceptFollow(cmd *cobra.Command, args []string) error {
 		if contains(domains, domain) {
 			cmd.Println("Accept [" + domain + "] follow request")
 			createFollowRequestResponse(domain, "Accept")
+			relayState.AddAudit(auditActor(), state.AuditAccept, domain, cmd.Flag("reason").Value.String())
 		} else {
 			cmd.Println("Invalid domain [" + domain + "] given")
 		}
@@ -188,6 +197,7 @@ func rejectFollow(cmd *cobra.Command, args []string) error {
 			if domain == request {
 				cmd.Println("Reject [" + domain + "] follow request")
 				createFollowRequestResponse(domain, "Reject")
+				relayState.AddAudit(auditActor(), state.AuditReject, domain, cmd.Flag("reason").Value.String())
 				break
 			}
 		}
@@ -198,11 +208,9 @@ func rejectFollow(cmd *cobra.Command, args []string) error {
 }
 
 func updateActor(cmd *cobra.Command, args []string) error {
-	for _, subscription := range relayState.Subscriptions {
-		err := createUpdateActorActivity(subscription)
-		if err != nil {
-			cmd.Println("Failed Update Actor for " + subscription.Domain)
-		}
+	err := createUpdateActorActivity(relayState.Subscriptions)
+	if err != nil {
+		cmd.Println("Failed Update Actor")
 	}
 	return nil
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func migrationCmdInit() *cobra.Command {
+	var migration = &cobra.Command{
+		Use:   "migration",
+		Short: "Show account migration log",
+		Long:  "Show account migrations verified from Move activities.",
+	}
+
+	var migrationList = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List account migrations",
+		Long:  "List account migrations which filtered by account or domain of old or new account.",
+		RunE:  listMigrations,
+	}
+	migrationList.Flags().StringP("account", "a", "", "Filter by old or new account ID")
+	migrationList.Flags().StringP("domain", "d", "", "Filter by domain of old or new account")
+	migration.AddCommand(migrationList)
+
+	return migration
+}
+
+func listMigrations(cmd *cobra.Command, args []string) error {
+	migrations, err := relayState.ListMigrations(cmd.Flag("account").Value.String(), cmd.Flag("domain").Value.String())
+	if err != nil {
+		return err
+	}
+	cmd.Println(" - Account migrations :")
+	for _, migration := range migrations {
+		cmd.Println(fmt.Sprintf("%s %s -> %s", migration.Timestamp.Local().Format("2006-01-02 15:04:05"), migration.From, migration.To))
+	}
+	cmd.Println(fmt.Sprintf("Total : %d", len(migrations)))
+
+	return nil
+}
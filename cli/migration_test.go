@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestListMigrations(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.AddMigration("https://a.example.com/users/example", "https://b.example.com/users/example", "")
+	relayState.AddMigration("https://c.example.com/users/other", "https://d.example.com/users/other", "")
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"migration", "list", "-d", "b.example.com"})
+	app.Execute()
+
+	lines := strings.Split(buffer.String(), "\n")
+	if len(lines) != 4 || lines[0] != " - Account migrations :" || !strings.HasSuffix(lines[1], " https://a.example.com/users/example -> https://b.example.com/users/example") || lines[2] != "Total : 1" {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
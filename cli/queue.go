@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/RichardKnop/machinery/v1/tasks"
+	"github.com/spf13/cobra"
+	queue "github.com/yukimochi/Activity-Relay/Queue"
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func queueCmdInit() *cobra.Command {
+	var queue = &cobra.Command{
+		Use:   "queue",
+		Short: "Manage delivery queue",
+		Long:  "Inspect, purge, pause and replay delivery jobs of worker.",
+	}
+
+	var queueStats = &cobra.Command{
+		Use:   "stats",
+		Short: "Show queue statistics",
+		Long:  "Show queue depth, age of oldest job, jobs per destination and per task type.",
+		RunE:  showQueueStats,
+	}
+	queue.AddCommand(queueStats)
+
+	var queuePurge = &cobra.Command{
+		Use:   "purge [flags]",
+		Short: "Purge jobs for domain",
+		Long:  "Drop queued and delayed jobs for destination domain.",
+		RunE:  purgeQueue,
+	}
+	queuePurge.Flags().StringP("domain", "d", "", "Destination domain")
+	queuePurge.MarkFlagRequired("domain")
+	queue.AddCommand(queuePurge)
+
+	var queuePause = &cobra.Command{
+		Use:   "pause [flags]",
+		Short: "Pause delivery to domain",
+		Long:  "Pause delivery to given domains without unsubscribing, jobs are kept in queue until resumed.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  pauseDomains,
+	}
+	queuePause.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	queue.AddCommand(queuePause)
+
+	var queueResume = &cobra.Command{
+		Use:   "resume [flags]",
+		Short: "Resume delivery to domain",
+		Long:  "Resume delivery to given paused domains.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  resumeDomains,
+	}
+	queueResume.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	queue.AddCommand(queueResume)
+
+	var dlq = &cobra.Command{
+		Use:   "dlq",
+		Short: "Manage dead-letter store",
+		Long:  "List, retry and purge delivery jobs given up by worker.",
+	}
+	queue.AddCommand(dlq)
+
+	var dlqList = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List dead letters",
+		Long:  "List delivery jobs given up by worker.",
+		RunE:  listDeadLetters,
+	}
+	dlqList.Flags().StringP("domain", "d", "", "Filter by destination domain")
+	dlq.AddCommand(dlqList)
+
+	var dlqRetry = &cobra.Command{
+		Use:   "retry [flags] [ids]",
+		Short: "Retry dead letters",
+		Long:  "Push dead letters back to delivery queue, given ids or all dead letters of domain.",
+		RunE:  retryDeadLetters,
+	}
+	dlqRetry.Flags().StringP("domain", "d", "", "Retry all dead letters of destination domain")
+	dlq.AddCommand(dlqRetry)
+
+	var dlqPurge = &cobra.Command{
+		Use:   "purge [flags]",
+		Short: "Purge dead letters",
+		Long:  "Delete dead letters of domain, or all dead letters with --all.",
+		RunE:  purgeDeadLetters,
+	}
+	dlqPurge.Flags().StringP("domain", "d", "", "Purge dead letters of destination domain")
+	dlqPurge.Flags().Bool("all", false, "Purge all dead letters")
+	dlq.AddCommand(dlqPurge)
+
+	return queue
+}
+
+func pushDeadLetterJob(letter *state.DeadLetter, body []byte) error {
+	retryCount := 0
+	if letter.Task == "registor" {
+		retryCount = queue.RegistorRetryCount
+	}
+	headers := queue.NewHeaders()
+	headers["attempts"] = letter.Attempts
+	job := &tasks.Signature{
+		Name:       letter.Task,
+		RetryCount: retryCount,
+		Headers:    headers,
+		Args: []tasks.Arg{
+			{
+				Name:  "inboxURL",
+				Type:  "string",
+				Value: letter.InboxURL,
+			},
+			{
+				Name:  "body",
+				Type:  "string",
+				Value: string(body),
+			},
+		},
+	}
+	_, err := machineryServer.SendTask(job)
+	return err
+}
+
+// sortedCounts : Keys of counts ordered by count descending
+func sortedCounts(counts map[string]int) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func showQueueStats(cmd *cobra.Command, args []string) error {
+	stats, err := queue.Inspect(relayState.RedisClient, machineryQueue)
+	if err != nil {
+		return err
+	}
+	cmd.Println(fmt.Sprintf("Queued : %d, Delayed : %d", stats.Queued, stats.Delayed))
+	if !stats.Oldest.IsZero() {
+		cmd.Println(fmt.Sprintf("Oldest job : %s ago", time.Since(stats.Oldest).Truncate(time.Second)))
+	}
+	cmd.Println(" - Task :")
+	for _, task := range sortedCounts(stats.ByTask) {
+		cmd.Println(fmt.Sprintf("%s : %d", task, stats.ByTask[task]))
+	}
+	cmd.Println(" - Destination :")
+	for _, domain := range sortedCounts(stats.ByDomain) {
+		cmd.Println(fmt.Sprintf("%s : %d", domain, stats.ByDomain[domain]))
+	}
+	cmd.Println(" - Paused domain :")
+	for _, domain := range relayState.PausedDomains {
+		cmd.Println(domain)
+	}
+
+	return nil
+}
+
+func purgeQueue(cmd *cobra.Command, args []string) error {
+	domain := cmd.Flag("domain").Value.String()
+	purged, err := queue.Purge(relayState.RedisClient, machineryQueue, domain)
+	if err != nil {
+		return err
+	}
+	relayState.AddAudit(auditActor(), state.AuditConfig, domain, fmt.Sprintf("Purge %d queued jobs", purged))
+	cmd.Println(fmt.Sprintf("Purged : %d", purged))
+
+	return nil
+}
+
+func pauseDomains(cmd *cobra.Command, args []string) error {
+	for _, domain := range args {
+		relayState.SetPausedDomain(domain, true)
+		relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Pause delivery : "+cmd.Flag("reason").Value.String())
+		cmd.Println("Pause delivery to [" + domain + "]")
+	}
+
+	return nil
+}
+
+func resumeDomains(cmd *cobra.Command, args []string) error {
+	for _, domain := range args {
+		relayState.SetPausedDomain(domain, false)
+		relayState.AddAudit(auditActor(), state.AuditConfig, domain, "Resume delivery : "+cmd.Flag("reason").Value.String())
+		cmd.Println("Resume delivery to [" + domain + "]")
+	}
+
+	return nil
+}
+
+func listDeadLetters(cmd *cobra.Command, args []string) error {
+	letters, err := relayState.ListDeadLetters(cmd.Flag("domain").Value.String())
+	if err != nil {
+		return err
+	}
+	cmd.Println(" - Dead letter :")
+	for _, letter := range letters {
+		cmd.Println(fmt.Sprintf("%s %s [%s] %s %d attempts : %s", letter.FailedAt.Local().Format("2006-01-02 15:04:05"), letter.ID, letter.Task, letter.InboxURL, letter.Attempts, letter.Error))
+	}
+	cmd.Println(fmt.Sprintf("Total : %d", len(letters)))
+
+	return nil
+}
+
+func retryDeadLetters(cmd *cobra.Command, args []string) error {
+	ids := args
+	domain := cmd.Flag("domain").Value.String()
+	if domain != "" {
+		letters, err := relayState.ListDeadLetters(domain)
+		if err != nil {
+			return err
+		}
+		for _, letter := range letters {
+			ids = append(ids, letter.ID)
+		}
+	}
+	if len(ids) == 0 {
+		cmd.Println("No dead letter given")
+		return nil
+	}
+	for _, id := range ids {
+		letter, body, err := relayState.SelectDeadLetter(id)
+		if err != nil {
+			cmd.Println("Invalid dead letter [" + id + "] given")
+			continue
+		}
+		err = pushDeadLetterJob(letter, body)
+		if err != nil {
+			cmd.Println("Cannot retry [" + id + "] : " + err.Error())
+			continue
+		}
+		relayState.DelDeadLetter(id)
+		cmd.Println("Retry [" + id + "] to " + letter.InboxURL)
+	}
+
+	return nil
+}
+
+func purgeDeadLetters(cmd *cobra.Command, args []string) error {
+	domain := cmd.Flag("domain").Value.String()
+	if domain == "" && cmd.Flag("all").Value.String() != "true" {
+		cmd.Println("Domain or --all must be given")
+		return nil
+	}
+	purged, err := relayState.PurgeDeadLetters(domain)
+	if err != nil {
+		return err
+	}
+	cmd.Println(fmt.Sprintf("Purged : %d", purged))
+
+	return nil
+}
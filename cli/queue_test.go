@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func TestListDeadLetters(t *testing.T) {
+	app := buildNewCmd()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	relayState.AddDeadLetter(state.DeadLetter{ID: "1", Task: "relay", Domain: "a.example.com", InboxURL: "https://a.example.com/inbox", Error: "500", Attempts: 1}, []byte("data"))
+	relayState.AddDeadLetter(state.DeadLetter{ID: "2", Task: "relay", Domain: "b.example.com", InboxURL: "https://b.example.com/inbox", Error: "500", Attempts: 1}, []byte("data"))
+
+	app.SetArgs([]string{"queue", "dlq", "list", "-d", "a.example.com"})
+	app.Execute()
+
+	output := buffer.String()
+	if !strings.Contains(output, "https://a.example.com/inbox") || strings.Contains(output, "https://b.example.com/inbox") || !strings.HasSuffix(output, "Total : 1\n") {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestRetryDeadLetters(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.AddDeadLetter(state.DeadLetter{ID: "1", Task: "registor", Domain: "a.example.com", InboxURL: "https://a.example.com/inbox", Attempts: 26}, []byte("data"))
+	relayState.AddDeadLetter(state.DeadLetter{ID: "2", Task: "relay", Domain: "a.example.com", InboxURL: "https://a.example.com/inbox", Attempts: 1}, []byte("data"))
+	relayState.AddDeadLetter(state.DeadLetter{ID: "3", Task: "relay", Domain: "b.example.com", InboxURL: "https://b.example.com/inbox", Attempts: 1}, []byte("data"))
+
+	app.SetArgs([]string{"queue", "dlq", "retry", "-d", "a.example.com"})
+	app.Execute()
+
+	letters, _ := relayState.ListDeadLetters("")
+	if len(letters) != 1 || letters[0].ID != "3" {
+		t.Fatalf("Not removed retried dead letters.")
+	}
+	queued, _ := relayState.RedisClient.LLen("relay").Result()
+	if queued != 2 {
+		t.Fatalf("Not pushed retried dead letters.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.AddDeadLetter(state.DeadLetter{ID: "1", Task: "relay", Domain: "a.example.com"}, []byte("data"))
+
+	app.SetArgs([]string{"queue", "dlq", "purge"})
+	app.Execute()
+
+	letters, _ := relayState.ListDeadLetters("")
+	if len(letters) != 1 {
+		t.Fatalf("Purged without domain or --all.")
+	}
+
+	app.SetArgs([]string{"queue", "dlq", "purge", "--all"})
+	app.Execute()
+
+	letters, _ = relayState.ListDeadLetters("")
+	if len(letters) != 0 {
+		t.Fatalf("Not purged dead letters.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestQueueStats(t *testing.T) {
+	app := buildNewCmd()
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	pushRegistorJob("https://a.example.com/inbox", []byte("data"))
+	pushRegistorJob("https://a.example.com/inbox", []byte("data"))
+	pushRegistorJob("https://b.example.com/inbox", []byte("data"))
+
+	app.SetArgs([]string{"queue", "stats"})
+	app.Execute()
+
+	output := buffer.String()
+	if !strings.Contains(output, "Queued : 3, Delayed : 0\nOldest job : ") || !strings.Contains(output, "registor : 3\n") || !strings.Contains(output, "a.example.com : 2\nb.example.com : 1\n") {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestQueuePurge(t *testing.T) {
+	app := buildNewCmd()
+
+	pushRegistorJob("https://a.example.com/inbox", []byte("data"))
+	pushRegistorJob("https://b.example.com/inbox", []byte("data"))
+
+	app.SetArgs([]string{"queue", "purge", "-d", "a.example.com"})
+	app.Execute()
+
+	queued, _ := relayState.RedisClient.LRange(machineryQueue, 0, -1).Result()
+	if len(queued) != 1 || !strings.Contains(queued[0], "https://b.example.com/inbox") {
+		t.Fatalf("Not purged jobs for domain.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestQueuePauseResume(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"queue", "pause", "a.example.com"})
+	app.Execute()
+
+	if len(relayState.PausedDomains) != 1 || relayState.PausedDomains[0] != "a.example.com" {
+		t.Fatalf("Not paused domain.")
+	}
+
+	app.SetArgs([]string{"queue", "resume", "a.example.com"})
+	app.Execute()
+
+	if len(relayState.PausedDomains) != 0 {
+		t.Fatalf("Not resumed domain.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
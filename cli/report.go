@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func reportsCmdInit() *cobra.Command {
+	var reports = &cobra.Command{
+		Use:   "reports",
+		Short: "Manage reports",
+		Long:  "List and resolve reports sent by subscribers as Flag activities, and apply or dismiss actions queued on reported domains.",
+	}
+
+	var reportsList = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List unresolved reports",
+		Long:  "List unresolved reports oldest first, filtered by domain of reporter or reported.",
+		RunE:  listReports,
+	}
+	reportsList.Flags().StringP("domain", "d", "", "Filter by domain of reporter or reported")
+	reports.AddCommand(reportsList)
+
+	var reportsResolve = &cobra.Command{
+		Use:   "resolve [flags]",
+		Short: "Resolve reports",
+		Long:  "Resolve given reports and remove them from reports queue.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  resolveReports,
+	}
+	reportsResolve.Flags().StringP("reason", "r", "", "Reason recorded in audit log")
+	reports.AddCommand(reportsResolve)
+
+	var reportsActions = &cobra.Command{
+		Use:   "actions",
+		Short: "List queued report actions",
+		Long:  "List actions on reported domains queued by report_approval, oldest first.",
+		RunE:  listReportActions,
+	}
+	reports.AddCommand(reportsActions)
+
+	var reportsApply = &cobra.Command{
+		Use:   "apply [flags]",
+		Short: "Apply queued report actions",
+		Long:  "Limit or block given reported domains by queued report actions.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  applyReportActions,
+	}
+	reports.AddCommand(reportsApply)
+
+	var reportsDismiss = &cobra.Command{
+		Use:   "dismiss [flags]",
+		Short: "Dismiss queued report actions",
+		Long:  "Remove queued report actions of given reported domains without applying them.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  dismissReportActions,
+	}
+	reports.AddCommand(reportsDismiss)
+
+	return reports
+}
+
+func listReports(cmd *cobra.Command, args []string) error {
+	reports, err := relayState.ListReports(cmd.Flag("domain").Value.String())
+	if err != nil {
+		return err
+	}
+	cmd.Println(" - Unresolved reports :")
+	for _, report := range reports {
+		line := fmt.Sprintf("%s [%s] %s reported %s", report.ReportedAt.Local().Format("2006-01-02 15:04:05"), report.ID, report.Reporter, strings.Join(report.Objects, " "))
+		if report.Content != "" {
+			line += " : " + report.Content
+		}
+		cmd.Println(line)
+	}
+	cmd.Println(fmt.Sprintf("Total : %d", len(reports)))
+
+	return nil
+}
+
+func resolveReports(cmd *cobra.Command, args []string) error {
+	reports, err := relayState.ListReports("")
+	if err != nil {
+		return err
+	}
+	for _, id := range args {
+		var resolved *state.Report
+		for i := range reports {
+			if reports[i].ID == id {
+				resolved = &reports[i]
+			}
+		}
+		if resolved == nil || relayState.ResolveReport(id) != nil {
+			cmd.Println("Invalid report [" + id + "] given")
+			continue
+		}
+		for _, domain := range resolved.ReportedDomains() {
+			relayState.AddAudit(auditActor(), state.AuditResolve, domain, "Report ["+id+"] resolved : "+cmd.Flag("reason").Value.String())
+		}
+		cmd.Println("Resolve [" + id + "]")
+	}
+
+	return nil
+}
+
+func listReportActions(cmd *cobra.Command, args []string) error {
+	actions, err := relayState.ListReportActions()
+	if err != nil {
+		return err
+	}
+	cmd.Println(" - Queued report actions :")
+	for _, action := range actions {
+		cmd.Println(fmt.Sprintf("%s %s [%s] : %s", action.QueuedAt.Local().Format("2006-01-02 15:04:05"), action.Action, action.Domain, action.Reason))
+	}
+	cmd.Println(fmt.Sprintf("Total : %d", len(actions)))
+
+	return nil
+}
+
+func queuedReportAction(domain string) *state.ReportAction {
+	actions, err := relayState.ListReportActions()
+	if err != nil {
+		return nil
+	}
+	for i := range actions {
+		if actions[i].Domain == domain {
+			return &actions[i]
+		}
+	}
+	return nil
+}
+
+func applyReportActions(cmd *cobra.Command, args []string) error {
+	for _, domain := range args {
+		action := queuedReportAction(domain)
+		if action == nil || relayState.DelReportAction(domain) != nil {
+			cmd.Println("Invalid report action [" + domain + "] given")
+			continue
+		}
+		switch action.Action {
+		case "limit":
+			relayState.SetLimitedDomain(domain, true)
+			relayState.AddAudit(auditActor(), state.AuditLimit, domain, action.Reason)
+			cmd.Println("Set [" + domain + "] as limited domain")
+		case "block":
+			relayState.SetBlockedDomain(domain, true)
+			relayState.AddAudit(auditActor(), state.AuditBlock, domain, action.Reason)
+			cmd.Println("Set [" + domain + "] as blocked domain")
+		default:
+			cmd.Println("Invalid report action [" + domain + "] given")
+		}
+	}
+
+	return nil
+}
+
+func dismissReportActions(cmd *cobra.Command, args []string) error {
+	for _, domain := range args {
+		if relayState.DelReportAction(domain) != nil {
+			cmd.Println("Invalid report action [" + domain + "] given")
+			continue
+		}
+		cmd.Println("Dismiss [" + domain + "]")
+	}
+
+	return nil
+}
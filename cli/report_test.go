@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func TestListReports(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.AddReport(state.Report{ID: "1", Reporter: "https://a.example.com/actor", Domain: "a.example.com", Objects: []string{"https://spam.example.com/users/spam"}, Content: "spam"})
+	relayState.AddReport(state.Report{ID: "2", Reporter: "https://b.example.com/actor", Domain: "b.example.com", Objects: []string{"https://other.example.com/users/other"}})
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"reports", "list", "-d", "spam.example.com"})
+	app.Execute()
+
+	lines := strings.Split(buffer.String(), "\n")
+	if len(lines) != 4 || lines[0] != " - Unresolved reports :" || !strings.HasSuffix(lines[1], " [1] https://a.example.com/actor reported https://spam.example.com/users/spam : spam") || lines[2] != "Total : 1" {
+		t.Fatalf("Invalid Response.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestResolveReports(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.AddReport(state.Report{ID: "1", Reporter: "https://a.example.com/actor", Domain: "a.example.com", Objects: []string{"https://spam.example.com/users/spam"}})
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"reports", "resolve", "-r", "suspended", "1", "2"})
+	app.Execute()
+
+	output := buffer.String()
+	if output != "Resolve [1]\nInvalid report [2] given\n" {
+		t.Fatalf("Invalid Response.")
+	}
+	reports, _ := relayState.ListReports("")
+	if len(reports) != 0 {
+		t.Fatalf("Not resolved report.")
+	}
+	entries, _ := relayState.ListAudit("spam.example.com", time.Time{}, time.Time{})
+	if len(entries) != 1 || entries[0].Action != state.AuditResolve || entries[0].Reason != "Report [1] resolved : suspended" {
+		t.Fatalf("Not recorded audit.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestApplyReportActions(t *testing.T) {
+	app := buildNewCmd()
+
+	relayState.QueueReportAction(state.ReportAction{Domain: "spam.example.com", Action: "block", Reason: "Reported by a.example.com, b.example.com"})
+	relayState.QueueReportAction(state.ReportAction{Domain: "other.example.com", Action: "limit"})
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"reports", "actions"})
+	app.Execute()
+
+	lines := strings.Split(buffer.String(), "\n")
+	if len(lines) != 5 || lines[0] != " - Queued report actions :" || !strings.HasSuffix(lines[1], " block [spam.example.com] : Reported by a.example.com, b.example.com") || lines[3] != "Total : 2" {
+		t.Fatalf("Invalid Response.")
+	}
+
+	buffer.Reset()
+	app.SetArgs([]string{"reports", "apply", "spam.example.com", "unknown.example.com"})
+	app.Execute()
+
+	output := buffer.String()
+	if output != "Set [spam.example.com] as blocked domain\nInvalid report action [unknown.example.com] given\n" {
+		t.Fatalf("Invalid Response.")
+	}
+	relayState.Load()
+	if !contains(relayState.BlockedDomains, "spam.example.com") {
+		t.Fatalf("Not applied report action.")
+	}
+	entries, _ := relayState.ListAudit("spam.example.com", time.Time{}, time.Time{})
+	if len(entries) != 1 || entries[0].Action != state.AuditBlock || entries[0].Reason != "Reported by a.example.com, b.example.com" {
+		t.Fatalf("Not recorded audit.")
+	}
+
+	buffer.Reset()
+	app.SetArgs([]string{"reports", "dismiss", "other.example.com", "spam.example.com"})
+	app.Execute()
+
+	output = buffer.String()
+	if output != "Dismiss [other.example.com]\nInvalid report action [spam.example.com] given\n" {
+		t.Fatalf("Invalid Response.")
+	}
+	relayState.Load()
+	if contains(relayState.LimitedDomains, "other.example.com") {
+		t.Fatalf("Applied dismissed report action.")
+	}
+	actions, _ := relayState.ListReportActions()
+	if len(actions) != 0 {
+		t.Fatalf("Not removed report actions.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
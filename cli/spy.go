@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	nodeinfo "github.com/yukimochi/Activity-Relay/Nodeinfo"
+	policy "github.com/yukimochi/Activity-Relay/Policy"
+	transport "github.com/yukimochi/Activity-Relay/Transport"
+)
+
+func spyCmdInit() *cobra.Command {
+	var spy = &cobra.Command{
+		Use:   "spy",
+		Short: "Inspect spy moderator",
+		Long:  "Inspect decisions of spy moderator.",
+	}
+
+	var spyPreview = &cobra.Command{
+		Use:   "preview",
+		Short: "Preview spy decisions",
+		Long:  "Evaluate current spy configuration against all follow requests and subscribers.\nNo follow request and subscriber is changed, no activity is sent.",
+		RunE:  previewSpy,
+	}
+	spy.AddCommand(spyPreview)
+
+	return spy
+}
+
+func spyModerator() (*policy.Moderator, error) {
+	moderator := &policy.Moderator{
+		Settings: policy.Settings{
+			AllowMaxUser:  viper.GetInt("allow_max_user"),
+			AllowMinUser:  viper.GetInt("allow_min_user"),
+			KickMaxUser:   viper.GetInt("kick_max_user"),
+			KickMinUser:   viper.GetInt("kick_min_user"),
+			MaxInstances:  viper.GetInt("max_instances"),
+			WhitelistMode: viper.GetBool("whitelist_mode"),
+			BlacklistMode: viper.GetBool("blacklist_mode"),
+			Whitelist:     viper.GetStringSlice("whitelist"),
+			Blacklist:     viper.GetStringSlice("blacklist"),
+		},
+	}
+	if viper.GetString("policy_file") != "" {
+		loaded, err := policy.Load(viper.GetString("policy_file"))
+		if err != nil {
+			return nil, err
+		}
+		moderator.Policy = loaded
+	}
+	return moderator, nil
+}
+
+func spyGrace() policy.Grace {
+	return policy.Grace{
+		Checks: viper.GetInt("kick_grace_checks"),
+		Period: viper.GetDuration("kick_grace_period"),
+	}
+}
+
+// previewKick : Preview kick of violating subscriber with same grace evaluation as spy
+func previewKick(inspector *policy.Inspector, grace policy.Grace, subject policy.Subject, now time.Time) string {
+	violation, _ := inspector.Violation(subject.Domain)
+	next := violation.Next(now, subject.CheckedAt)
+	if grace.Expired(next, now) {
+		return "kick"
+	}
+	checks, until := grace.Until(next)
+	var limits []string
+	if !until.IsZero() {
+		limits = append(limits, "until "+until.Local().Format("2006-01-02 15:04:05"))
+	}
+	if checks > 0 {
+		limits = append(limits, fmt.Sprintf("%d more checks", checks))
+	}
+	action := "grace " + strings.Join(limits, " or ")
+	if viper.GetBool("kick_warning") && !violation.Warned {
+		action = "warn/" + action
+	}
+	return action
+}
+
+func spyInspector(cmd *cobra.Command, moderator *policy.Moderator) *policy.Inspector {
+	uaString := fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostname.Host)
+	nodeinfoCacheTTL := viper.GetDuration("nodeinfo_cache_ttl")
+	if nodeinfoCacheTTL == 0 {
+		nodeinfoCacheTTL = time.Hour
+	}
+	httpClient, err := transport.NewClient(transport.LoadConfig())
+	if err != nil {
+		cmd.Println("Invalid HTTP client configuration : " + err.Error())
+		httpClient = &http.Client{Timeout: time.Duration(10) * time.Second}
+	}
+	blocklist := policy.NewBlocklist()
+	if moderator.Policy != nil && len(moderator.Policy.BlocklistFeeds) > 0 {
+		err := blocklist.Refresh(&http.Client{Transport: httpClient.Transport, Timeout: time.Duration(30) * time.Second}, moderator.Policy.BlocklistFeeds, uaString)
+		if err != nil {
+			cmd.Println("Cannot refresh blocklist : " + err.Error())
+		}
+	}
+	nodeinfoClient := nodeinfo.NewClient(relayState.RedisClient, uaString, nodeinfoCacheTTL)
+	nodeinfoClient.HTTPClient = httpClient
+	return &policy.Inspector{
+		RedisClient: relayState.RedisClient,
+		Nodeinfo:    nodeinfoClient,
+		Blocklist:   blocklist,
+		ByTotal:     viper.GetBool("user_by_total"),
+	}
+}
+
+func previewSpy(cmd *cobra.Command, args []string) error {
+	moderator, err := spyModerator()
+	if err != nil {
+		return err
+	}
+	inspector := spyInspector(cmd, moderator)
+
+	follows, err := relayState.RedisClient.Keys("relay:pending:*").Result()
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	subscribers := len(relayState.Subscriptions)
+
+	cmd.Println(" - Follow request :")
+	for _, follow := range follows {
+		domain := strings.Replace(follow, "relay:pending:", "", 1)
+		subject, _ := inspector.Subject(domain, subscribers)
+		decision := moderator.Permit(subject)
+		counts[string(decision.Action)]++
+		cmd.Println(fmt.Sprintf("%s : %s by %s : %s", domain, decision.Action, decision.Rule, decision.Reason))
+	}
+
+	cmd.Println(" - Subscriber :")
+	grace := spyGrace()
+	now := time.Now()
+	for _, subscription := range relayState.Subscriptions {
+		subject, _ := inspector.Subject(subscription.Domain, subscribers)
+		decision := moderator.Review(subject)
+		action := "keep"
+		switch decision.Action {
+		case policy.Reject:
+			action = previewKick(inspector, grace, subject, now)
+		case policy.Hold:
+			action = "hold"
+		}
+		if strings.Contains(action, "grace") {
+			counts["grace"]++
+		} else {
+			counts[action]++
+		}
+		cmd.Println(fmt.Sprintf("%s : %s by %s : %s", subscription.Domain, action, decision.Rule, decision.Reason))
+	}
+	cmd.Println(fmt.Sprintf("Accept : %d, Reject : %d, Hold : %d, Kick : %d, Grace : %d", counts["accept"], counts["reject"], counts["hold"], counts["kick"], counts["grace"]))
+
+	return nil
+}
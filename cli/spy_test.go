@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPreviewSpy(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"config", "import", "--json", "../misc/exampleConfig.json"})
+	app.Execute()
+	relayState.RedisClient.HMSet("relay:pending:pending.example.jp", map[string]interface{}{
+		"inbox_url":   "https://pending.example.jp/inbox",
+		"activity_id": "https://pending.example.jp/UUID",
+		"type":        "Follow",
+		"actor":       "https://pending.example.jp/user/example",
+		"object":      "https://www.w3.org/ns/activitystreams#Public",
+	})
+	viper.Set("blacklist_mode", true)
+	viper.Set("blacklist", []string{"\\.example\\.jp$"})
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"spy", "preview"})
+	app.Execute()
+
+	output := buffer.String()
+	valid := ` - Follow request :
+pending.example.jp : reject by whitelist/blacklist : Blacklist/whitelist policy
+ - Subscriber :
+subscription.example.jp : kick by whitelist/blacklist : Blacklist/whitelist policy
+Accept : 0, Reject : 1, Hold : 0, Kick : 1, Grace : 0
+`
+	if output != valid {
+		t.Fatalf("Invalid Response.")
+	}
+
+	exists, _ := relayState.RedisClient.Exists("relay:pending:pending.example.jp", "relay:subscription:subscription.example.jp").Result()
+	if exists != 2 {
+		t.Fatalf("Preview changed follow request or subscriber.")
+	}
+
+	viper.Set("blacklist_mode", false)
+	viper.Set("blacklist", []string{})
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestPreviewSpyWithGrace(t *testing.T) {
+	app := buildNewCmd()
+
+	app.SetArgs([]string{"config", "import", "--json", "../misc/exampleConfig.json"})
+	app.Execute()
+	viper.Set("blacklist_mode", true)
+	viper.Set("blacklist", []string{"\\.example\\.jp$"})
+	viper.Set("kick_grace_checks", 3)
+	viper.Set("kick_warning", true)
+
+	buffer := new(bytes.Buffer)
+	app.SetOutput(buffer)
+
+	app.SetArgs([]string{"spy", "preview"})
+	app.Execute()
+
+	output := buffer.String()
+	valid := ` - Follow request :
+ - Subscriber :
+subscription.example.jp : warn/grace 2 more checks by whitelist/blacklist : Blacklist/whitelist policy
+Accept : 0, Reject : 0, Hold : 0, Kick : 0, Grace : 1
+`
+	if output != valid {
+		t.Fatalf("Invalid Response.")
+	}
+
+	exists, _ := relayState.RedisClient.Exists("relay:spy:violation:subscription.example.jp").Result()
+	if exists != 0 {
+		t.Fatalf("Preview recorded violation.")
+	}
+
+	viper.Set("blacklist_mode", false)
+	viper.Set("blacklist", []string{})
+	viper.Set("kick_grace_checks", 0)
+	viper.Set("kick_warning", false)
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
@@ -15,32 +17,151 @@ import (
 	"github.com/yukimochi/httpsig"
 )
 
-func decodeActivity(request *http.Request) (*activitypub.Activity, *activitypub.Actor, []byte, error) {
+func verifySignature(request *http.Request) (*activitypub.Actor, error) {
 	request.Header.Set("Host", request.Host)
-	dataLen, _ := strconv.Atoi(request.Header.Get("Content-Length"))
-	body := make([]byte, dataLen)
-	request.Body.Read(body)
-
-	// Verify HTTPSignature
 	verifier, err := httpsig.NewVerifier(request)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	KeyID := verifier.KeyId()
+	_, cached := actorCache.Get(KeyID)
+	keyOwnerActor, err := verifyWithKey(verifier, KeyID)
+	if err != nil && cached {
+		// Key may be rotated, refetch once
+		actorCache.Delete(KeyID)
+		var refetchErr error
+		keyOwnerActor, refetchErr = verifyWithKey(verifier, KeyID)
+		if refetchErr == activitypub.ErrGone {
+			// Signature failed with known key, it is not Delete of gone actor
+			return nil, err
+		}
+		err = refetchErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyOwnerActor, nil
+}
+
+// signatureKeyID : KeyId of HTTP Signature, it is not verified
+func signatureKeyID(request *http.Request) string {
+	verifier, err := httpsig.NewVerifier(request)
+	if err != nil {
+		return ""
+	}
+	return verifier.KeyId()
+}
+
+// keyOwnerID : Actor document of keyId, keyId is fragment of actor document in common
+func keyOwnerID(keyID string) string {
+	return strings.SplitN(keyID, "#", 2)[0]
+}
+
+// signedByActor : Request is signed with key of activity's actor itself
+func signedByActor(keyID string, activity *activitypub.Activity, actor *activitypub.Actor) bool {
+	if keyID == "" {
+		return false
+	}
+	return keyID == actor.PublicKey.ID || keyOwnerID(keyID) == string(activity.Actor)
+}
+
+func verifyWithKey(verifier httpsig.Verifier, KeyID string) (*activitypub.Actor, error) {
 	keyOwnerActor := new(activitypub.Actor)
-	err = keyOwnerActor.RetrieveRemoteActor(KeyID, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostURL.Host), actorCache)
+	err := keyOwnerActor.RetrieveRemoteActor(KeyID, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostURL.Host), actorCache, fetchKey)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	PubKey, err := keyloader.ReadPublicKeyRSAfromString(keyOwnerActor.PublicKey.PublicKeyPem)
 	if PubKey == nil {
-		return nil, nil, nil, errors.New("Failed parse PublicKey from string")
+		return nil, errors.New("Failed parse PublicKey from string")
 	}
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	err = verifier.Verify(PubKey, httpsig.RSA_SHA256)
 	if err != nil {
+		return nil, err
+	}
+	return keyOwnerActor, nil
+}
+
+// DefaultMaxBodySize : Max size of inbox body when max_body_size is not set
+const DefaultMaxBodySize = 1 << 20
+
+var (
+	errGoneActorDropped = errors.New("Delete of gone actor is dropped")
+	errBodyTooLarge     = errors.New("Request body is too large")
+)
+
+func readBody(request *http.Request) ([]byte, error) {
+	limit := maxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	if request.ContentLength > limit {
+		return nil, errBodyTooLarge
+	}
+	if request.Body == nil {
+		return nil, errors.New("Request body is empty")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+	if len(body) == 0 {
+		return nil, errors.New("Request body is empty")
+	}
+	return body, nil
+}
+
+func selfDelete(activity *activitypub.Activity) bool {
+	return activity.Type == "Delete" && activity.ObjectID() == string(activity.Actor)
+}
+
+// verifyMove : Move is acceptable when actor moves itself and target lists actor in alsoKnownAs
+func verifyMove(activity *activitypub.Activity) error {
+	if activity.ObjectID() != string(activity.Actor) {
+		return errors.New("Move should move actor itself")
+	}
+	target := string(activity.Target)
+	if target == "" || target == string(activity.Actor) {
+		return errors.New("Move should have target other than actor")
+	}
+	// Alias may be added just before Move, cached target is not trusted
+	actorCache.Delete(target)
+	var targetActor activitypub.Actor
+	err := targetActor.RetrieveRemoteActor(target, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostURL.Host), actorCache, fetchKey)
+	if err != nil {
+		return errors.New("Failed to retrieve target : " + err.Error())
+	}
+	if targetActor.ID != target || !contains(targetActor.AlsoKnownAs, string(activity.Actor)) {
+		return errors.New("Target does not list actor in alsoKnownAs")
+	}
+	return nil
+}
+
+func decodeActivity(request *http.Request) (*activitypub.Activity, *activitypub.Actor, []byte, error) {
+	body, err := readBody(request)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Verify HTTPSignature
+	keyOwnerActor, err := verifySignature(request)
+	unverified := err == activitypub.ErrGone
+	if unverified {
+		// Key owner is deleted, only Delete of itself is passed by policy
+		var activity activitypub.Activity
+		if json.Unmarshal(body, &activity) != nil || !selfDelete(&activity) || keyOwnerID(signatureKeyID(request)) != string(activity.Actor) {
+			return nil, nil, nil, err
+		}
+		if goneActorDelete != "accept" {
+			return nil, nil, nil, errGoneActorDropped
+		}
+	} else if err != nil {
 		return nil, nil, nil, err
 	}
 
@@ -63,8 +184,17 @@ func decodeActivity(request *http.Request) (*activitypub.Activity, *activitypub.
 	}
 
 	var remoteActor activitypub.Actor
-	err = remoteActor.RetrieveRemoteActor(activity.Actor, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostURL.Host), actorCache)
-	if err != nil {
+	err = remoteActor.RetrieveRemoteActor(string(activity.Actor), fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostURL.Host), actorCache, fetchKey)
+	if unverified && err != activitypub.ErrGone {
+		// Signature is not verified, actor itself should be gone
+		return nil, nil, nil, errors.New("Actor of unverified Delete is not gone")
+	} else if err == activitypub.ErrGone && selfDelete(&activity) {
+		if keyOwnerActor != nil && keyOwnerActor.ID == string(activity.Actor) {
+			remoteActor = *keyOwnerActor
+		} else {
+			remoteActor = activitypub.Actor{ID: string(activity.Actor)}
+		}
+	} else if err != nil {
 		return nil, nil, nil, err
 	}
 
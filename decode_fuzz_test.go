@@ -0,0 +1,80 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+)
+
+func addFuzzSeeds(f *testing.F) {
+	files, _ := filepath.Glob("./misc/*.json")
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err == nil {
+			f.Add(body)
+		}
+	}
+	f.Add([]byte(`{"type":"Create","actor":"https://remote.yukimochi.example.org/actor","object":"https://remote.yukimochi.example.org/notes/1"}`))
+	f.Add([]byte(`{"type":"Delete","actor":"https://remote.yukimochi.example.org/actor","object":{"id":"https://remote.yukimochi.example.org/actor"}}`))
+	f.Add([]byte(`{"type":"Follow","actor":"%zz","object":"https://www.w3.org/ns/activitystreams#Public"}`))
+	f.Add([]byte(``))
+}
+
+func FuzzDecodeActivity(f *testing.F) {
+	addFuzzSeeds(f)
+	actorID := "https://remote.yukimochi.example.org/actor"
+	keyID := mockRemoteKey(actorID)
+	// Actor document is same as key document, signature of every input is verified
+	actorData, _ := actorCache.Get(keyID)
+	actorCache.Set(actorID, actorData)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		hash := sha256.Sum256(body)
+		req, _ := http.NewRequest("POST", "https://"+hostURL.Host+"/inbox", bytes.NewReader(body))
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(hash[:]))
+		key := activitypub.FetchKey{KeyID: keyID, PrivateKey: hostPrivatekey}
+		key.SignRequest(req)
+
+		activity, actor, decoded, err := decodeActivity(req)
+		if err != nil {
+			return
+		}
+		if activity == nil || actor == nil || !bytes.Equal(decoded, body) {
+			t.Fatalf("Failed - Decoded activity is invalid.")
+		}
+	})
+}
+
+func FuzzHandleInbox(f *testing.F) {
+	addFuzzSeeds(f)
+	actor := mockActor("Person")
+	f.Cleanup(func() {
+		relayState.RedisClient.FlushAll().Result()
+	})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		decoder := func(r *http.Request) (*activitypub.Activity, *activitypub.Actor, []byte, error) {
+			var activity activitypub.Activity
+			err := json.Unmarshal(body, &activity)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return &activity, &actor, body, nil
+		}
+		req := httptest.NewRequest("POST", "/inbox", bytes.NewReader(body))
+		handleInbox(httptest.NewRecorder(), req, decoder)
+	})
+}
@@ -2,13 +2,23 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"testing"
+	"testing/iotest"
 
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
 
@@ -34,7 +44,7 @@ func TestDecodeActivity(t *testing.T) {
 		t.Fatalf("Failed - " + err.Error())
 	}
 
-	if activity.Actor != actor.ID {
+	if string(activity.Actor) != actor.ID {
 		fmt.Println(actor.ID)
 		t.Fatalf("Failed - retrieved actor is invalid")
 	}
@@ -115,3 +125,177 @@ func TestDecodeActivityWithInvalidDigest(t *testing.T) {
 
 	relayState.DelSubscription("innocent.yukimochi.io")
 }
+
+func TestVerifySignatureRotatedKey(t *testing.T) {
+	fetched := 0
+	var actorData []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		w.Write(actorData)
+	}))
+	defer s.Close()
+
+	keyID := s.URL + "/actor#main-key"
+	publicKey, _ := x509.MarshalPKIXPublicKey(&hostPrivatekey.PublicKey)
+	actorData, _ = json.Marshal(&activitypub.Actor{
+		ID:        s.URL + "/actor",
+		PublicKey: activitypub.PublicKey{ID: keyID, PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))},
+	})
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	oldPublicKey, _ := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	oldActorData, _ := json.Marshal(&activitypub.Actor{
+		ID:        s.URL + "/actor",
+		PublicKey: activitypub.PublicKey{ID: keyID, PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: oldPublicKey}))},
+	})
+	actorCache.Set(keyID, oldActorData)
+	defer actorCache.Delete(keyID)
+
+	req, _ := http.NewRequest("GET", "https://"+hostURL.Host+"/actor", nil)
+	key := activitypub.FetchKey{KeyID: keyID, PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	_, err := verifySignature(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if fetched != 1 {
+		t.Fatalf("Failed - Rotated key not refetched once.")
+	}
+}
+
+func mockGoneDelete(actorID string) *http.Request {
+	return mockGoneDeleteSignedBy(actorID, actorID+"#main-key")
+}
+
+func mockGoneDeleteSignedBy(actorID string, keyID string) *http.Request {
+	body := []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"` + actorID + `#delete","type":"Delete","actor":"` + actorID + `","object":"` + actorID + `","to":["https://www.w3.org/ns/activitystreams#Public"]}`)
+	hash := sha256.Sum256(body)
+	req, _ := http.NewRequest("POST", "https://"+hostURL.Host+"/inbox", bytes.NewReader(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(hash[:]))
+	key := activitypub.FetchKey{KeyID: keyID, PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	return req
+}
+
+func TestDecodeActivityGoneActorDelete(t *testing.T) {
+	fetched := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		w.WriteHeader(410)
+	}))
+	defer s.Close()
+	actorID := s.URL + "/users/gone"
+
+	_, _, _, err := decodeActivity(mockGoneDelete(actorID))
+	if err != errGoneActorDropped {
+		t.Fatalf("Failed - Delete of gone actor not dropped.")
+	}
+	_, _, _, err = decodeActivity(mockGoneDelete(actorID))
+	if err != errGoneActorDropped || fetched != 1 {
+		t.Fatalf("Failed - Gone actor fetched again.")
+	}
+
+	goneActorDelete = "accept"
+	defer func() { goneActorDelete = "" }()
+	activity, actor, _, err := decodeActivity(mockGoneDelete(actorID))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if activity.Type != "Delete" || actor.ID != actorID || fetched != 1 {
+		t.Fatalf("Failed - Delete of gone actor not accepted.")
+	}
+}
+
+func TestDecodeActivityGoneActorDeleteOtherKey(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(410)
+	}))
+	defer s.Close()
+	actorID := s.URL + "/users/victim"
+
+	goneActorDelete = "accept"
+	defer func() { goneActorDelete = "" }()
+	_, _, _, err := decodeActivity(mockGoneDeleteSignedBy(actorID, s.URL+"/users/other#main-key"))
+	if err != activitypub.ErrGone {
+		t.Fatalf("Failed - Delete signed by other gone key accepted.")
+	}
+}
+
+func TestDecodeActivityGoneActorDeleteInvalidCachedKey(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(410)
+	}))
+	defer s.Close()
+	actorID := s.URL + "/users/rotated"
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	publicKey, _ := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	actorData, _ := json.Marshal(&activitypub.Actor{
+		ID:        actorID,
+		Type:      "Person",
+		PublicKey: activitypub.PublicKey{ID: actorID + "#main-key", PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))},
+	})
+	actorCache.Set(actorID+"#main-key", actorData)
+	defer actorCache.Delete(actorID + "#main-key")
+
+	goneActorDelete = "accept"
+	defer func() { goneActorDelete = "" }()
+	_, _, _, err := decodeActivity(mockGoneDelete(actorID))
+	if err == nil || err == activitypub.ErrGone {
+		t.Fatalf("Failed - Signature error not returned for cached key.")
+	}
+}
+
+func TestDecodeActivityGoneActorDeleteCachedKey(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(410)
+	}))
+	defer s.Close()
+	actorID := s.URL + "/users/cached"
+	publicKey, _ := x509.MarshalPKIXPublicKey(&hostPrivatekey.PublicKey)
+	actorData, _ := json.Marshal(&activitypub.Actor{
+		ID:        actorID,
+		Type:      "Person",
+		PublicKey: activitypub.PublicKey{ID: actorID + "#main-key", PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))},
+	})
+	actorCache.Set(actorID+"#main-key", actorData)
+	defer actorCache.Delete(actorID + "#main-key")
+
+	activity, actor, _, err := decodeActivity(mockGoneDelete(actorID))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if activity.Type != "Delete" || actor.Type != "Person" {
+		t.Fatalf("Failed - Delete not verified with cached key.")
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	maxBodySize = 16
+	defer func() { maxBodySize = 0 }()
+
+	req, _ := http.NewRequest("POST", "/inbox", iotest.OneByteReader(bytes.NewReader([]byte(`{"type":"Note"}`))))
+	req.ContentLength = -1
+	body, err := readBody(req)
+	if err != nil || string(body) != `{"type":"Note"}` {
+		t.Fatalf("Failed - Chunked body not read fully.")
+	}
+
+	req, _ = http.NewRequest("POST", "/inbox", bytes.NewReader(make([]byte, 17)))
+	_, err = readBody(req)
+	if err != errBodyTooLarge {
+		t.Fatalf("Failed - Large body accepted.")
+	}
+
+	req, _ = http.NewRequest("POST", "/inbox", iotest.OneByteReader(bytes.NewReader(make([]byte, 17))))
+	req.ContentLength = -1
+	_, err = readBody(req)
+	if err != errBodyTooLarge {
+		t.Fatalf("Failed - Large chunked body accepted.")
+	}
+
+	req, _ = http.NewRequest("POST", "/inbox", nil)
+	_, err = readBody(req)
+	if err == nil {
+		t.Fatalf("Failed - Empty body accepted.")
+	}
+}
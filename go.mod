@@ -6,9 +6,10 @@ require (
 	github.com/RichardKnop/machinery v1.7.8
 	github.com/Songmu/go-httpdate v1.0.0
 	github.com/go-redis/redis v6.15.7+incompatible
-	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/satori/go.uuid v1.2.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.0
 	github.com/yukimochi/httpsig v0.1.3
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -4,12 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/RichardKnop/machinery/v1/tasks"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	queue "github.com/yukimochi/Activity-Relay/Queue"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
 
@@ -69,8 +75,31 @@ func handleNodeinfo(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// authorizeFetch : Require HTTP Signature from non-blocked domain if authorized fetch is enabled
+func authorizeFetch(writer http.ResponseWriter, request *http.Request) bool {
+	if !authorizedFetch {
+		return true
+	}
+	keyOwner, err := verifySignature(request)
+	if err != nil {
+		writer.WriteHeader(401)
+		writer.Write([]byte(err.Error()))
+		return false
+	}
+	domain, err := url.Parse(keyOwner.ID)
+	if err != nil || contains(relayState.BlockedDomains, domain.Host) {
+		writer.WriteHeader(403)
+		writer.Write(nil)
+		return false
+	}
+	return true
+}
+
 func handleActor(writer http.ResponseWriter, request *http.Request) {
 	if request.Method == "GET" {
+		if !authorizeFetch(writer, request) {
+			return
+		}
 		actor, err := json.Marshal(&Actor)
 		if err != nil {
 			panic(err)
@@ -84,6 +113,128 @@ func handleActor(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+const collectionPageSize = 50
+
+func subscriberActors() []interface{} {
+	var actors []string
+	for _, subscription := range relayState.Subscriptions {
+		if subscription.ActorID != "" {
+			actors = append(actors, subscription.ActorID)
+		}
+	}
+	sort.Strings(actors)
+	var items []interface{}
+	for _, actor := range actors {
+		items = append(items, actor)
+	}
+	return items
+}
+
+func pageOf(items []interface{}, offset int, count int) []interface{} {
+	if offset >= len(items) {
+		return nil
+	}
+	if offset+count < len(items) {
+		return items[offset : offset+count]
+	}
+	return items[offset:]
+}
+
+func handleCollection(writer http.ResponseWriter, request *http.Request, id string, public bool, totalItems int, items func(offset int, count int) []interface{}) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+	var collection activitypub.OrderedCollection
+	page := request.URL.Query().Get("page")
+	if page == "" {
+		collection = activitypub.GenerateOrderedCollection(id, totalItems, public)
+	} else {
+		if !public {
+			writer.WriteHeader(404)
+			writer.Write(nil)
+			return
+		}
+		pageNum, err := strconv.Atoi(page)
+		if err != nil || pageNum < 1 {
+			writer.WriteHeader(400)
+			writer.Write(nil)
+			return
+		}
+		collection = activitypub.GenerateOrderedCollectionPage(id, items((pageNum-1)*collectionPageSize, collectionPageSize), totalItems, pageNum, collectionPageSize)
+	}
+	resource, err := json.Marshal(&collection)
+	if err != nil {
+		panic(err)
+	}
+	writer.Header().Add("Content-Type", "application/activity+json")
+	writer.WriteHeader(200)
+	writer.Write(resource)
+}
+
+func handleFollowers(writer http.ResponseWriter, request *http.Request) {
+	actors := subscriberActors()
+	handleCollection(writer, request, Actor.Followers, publicCollections, len(actors), func(offset int, count int) []interface{} {
+		return pageOf(actors, offset, count)
+	})
+}
+
+func handleFollowing(writer http.ResponseWriter, request *http.Request) {
+	handleCollection(writer, request, Actor.Following, true, 0, func(offset int, count int) []interface{} {
+		return nil
+	})
+}
+
+func handleOutbox(writer http.ResponseWriter, request *http.Request) {
+	totalItems, _ := relayState.CountOutbox()
+	handleCollection(writer, request, Actor.Outbox, true, totalItems, func(offset int, count int) []interface{} {
+		var items []interface{}
+		activities, _ := relayState.ListOutbox(offset, count)
+		for _, activity := range activities {
+			items = append(items, json.RawMessage(activity))
+		}
+		return items
+	})
+}
+
+func handleActivity(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+	if !authorizeFetch(writer, request) {
+		return
+	}
+	activity, err := relayState.SelectActivity(hostURL.String() + request.URL.Path)
+	if err != nil {
+		writer.WriteHeader(404)
+		writer.Write(nil)
+		return
+	}
+	writer.Header().Add("Content-Type", activityContentType(request))
+	writer.WriteHeader(200)
+	writer.Write(activity)
+}
+
+func activityContentType(request *http.Request) string {
+	if strings.Contains(request.Header.Get("Accept"), "application/ld+json") && !strings.Contains(request.Header.Get("Accept"), "application/activity+json") {
+		return "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	}
+	return "application/activity+json"
+}
+
+// storeActivity : Store relay generated activity to be dereferenceable, public one is listed in outbox
+func storeActivity(activity *activitypub.Activity, public bool) []byte {
+	jsonData, _ := json.Marshal(activity)
+	err := relayState.AddActivity(activity.ID, jsonData, public)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return jsonData
+}
+
 func contains(entries interface{}, finder string) bool {
 	switch entry := entries.(type) {
 	case string:
@@ -95,6 +246,8 @@ func contains(entries interface{}, finder string) bool {
 			}
 		}
 		return false
+	case activitypub.Strings:
+		return contains([]string(entry), finder)
 	case []state.Subscription:
 		for i := 0; i < len(entry); i++ {
 			if entry[i].Domain == finder {
@@ -107,11 +260,18 @@ func contains(entries interface{}, finder string) bool {
 }
 
 func pushRelayJob(sourceInbox string, body []byte) {
+	bodies := newRelayBodies(body)
 	for _, domain := range relayState.Subscriptions {
 		if sourceInbox != domain.Domain {
+			jsonData, err := bodies.bodyFor(domain)
+			if err != nil {
+				fmt.Println("Skipping Relay Status : ", err.Error(), domain.Domain)
+				continue
+			}
 			job := &tasks.Signature{
 				Name:       "relay",
 				RetryCount: 0,
+				Headers:    queue.NewHeaders(),
 				Args: []tasks.Arg{
 					{
 						Name:  "inboxURL",
@@ -121,11 +281,11 @@ func pushRelayJob(sourceInbox string, body []byte) {
 					{
 						Name:  "body",
 						Type:  "string",
-						Value: string(body),
+						Value: string(jsonData),
 					},
 				},
 			}
-			_, err := machineryServer.SendTask(job)
+			_, err = machineryServer.SendTask(job)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 			}
@@ -136,7 +296,8 @@ func pushRelayJob(sourceInbox string, body []byte) {
 func pushRegistorJob(inboxURL string, body []byte) {
 	job := &tasks.Signature{
 		Name:       "registor",
-		RetryCount: 2,
+		RetryCount: queue.RegistorRetryCount,
+		Headers:    queue.NewHeaders(),
 		Args: []tasks.Arg{
 			{
 				Name:  "inboxURL",
@@ -157,7 +318,7 @@ func pushRegistorJob(inboxURL string, body []byte) {
 }
 
 func followAcceptable(activity *activitypub.Activity, actor *activitypub.Actor) error {
-	if contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public") {
+	if activity.ObjectID() == "https://www.w3.org/ns/activitystreams#Public" {
 		return nil
 	} else {
 		return errors.New("Follow only allowed for https://www.w3.org/ns/activitystreams#Public")
@@ -165,7 +326,7 @@ func followAcceptable(activity *activitypub.Activity, actor *activitypub.Actor)
 }
 
 func unFollowAcceptable(activity *activitypub.Activity, actor *activitypub.Actor) error {
-	if contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public") {
+	if activity.ObjectID() == "https://www.w3.org/ns/activitystreams#Public" {
 		return nil
 	} else {
 		return errors.New("Unfollow only allowed for https://www.w3.org/ns/activitystreams#Public")
@@ -173,18 +334,40 @@ func unFollowAcceptable(activity *activitypub.Activity, actor *activitypub.Actor
 }
 
 func suitableFollow(activity *activitypub.Activity, actor *activitypub.Actor) bool {
-	domain, _ := url.Parse(activity.Actor)
-	if contains(relayState.BlockedDomains, domain.Host) {
+	domain, err := url.Parse(string(activity.Actor))
+	if err != nil || contains(relayState.BlockedDomains, domain.Host) {
 		return false
 	}
 	return true
 }
 
+// invalidateActor : Drop cached actor and key when actor itself is updated or deleted with its own key
+func invalidateActor(activity *activitypub.Activity, actor *activitypub.Actor, keyID string) {
+	if !contains(activity.ObjectIDs(), string(activity.Actor)) || !signedByActor(keyID, activity, actor) {
+		return
+	}
+	if activity.Type == "Delete" {
+		actorCache.MarkGone(string(activity.Actor))
+		if actor.PublicKey.ID != "" {
+			actorCache.MarkGone(actor.PublicKey.ID)
+		}
+		return
+	}
+	actorCache.Delete(string(activity.Actor))
+	if actor.PublicKey.ID != "" {
+		actorCache.Delete(actor.PublicKey.ID)
+	}
+}
+
 func relayAcceptable(activity *activitypub.Activity, actor *activitypub.Actor) error {
-	if !contains(activity.To, "https://www.w3.org/ns/activitystreams#Public") && !contains(activity.Cc, "https://www.w3.org/ns/activitystreams#Public") {
+	// Move is addressed to followers, verification of target is required instead
+	if activity.Type != "Move" && !contains(activity.To, "https://www.w3.org/ns/activitystreams#Public") && !contains(activity.Cc, "https://www.w3.org/ns/activitystreams#Public") {
 		return errors.New("Activity should contain https://www.w3.org/ns/activitystreams#Public as receiver")
 	}
-	domain, _ := url.Parse(activity.Actor)
+	domain, err := url.Parse(string(activity.Actor))
+	if err != nil {
+		return err
+	}
 	if contains(relayState.Subscriptions, domain.Host) {
 		return nil
 	}
@@ -192,8 +375,8 @@ func relayAcceptable(activity *activitypub.Activity, actor *activitypub.Actor) e
 }
 
 func suitableRelay(activity *activitypub.Activity, actor *activitypub.Actor) bool {
-	domain, _ := url.Parse(activity.Actor)
-	if contains(relayState.LimitedDomains, domain.Host) {
+	domain, err := url.Parse(string(activity.Actor))
+	if err != nil || contains(relayState.LimitedDomains, domain.Host) {
 		return false
 	}
 	if relayState.RelayConfig.BlockService && actor.Type != "Person" {
@@ -202,22 +385,142 @@ func suitableRelay(activity *activitypub.Activity, actor *activitypub.Actor) boo
 	return true
 }
 
+func clientIP(request *http.Request) string {
+	if realIPHeader != "" {
+		if forwarded := request.Header.Get(realIPHeader); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+func domainRateLimit(domain string) state.RateLimit {
+	if limit, ok := relayState.RateLimits[domain]; ok {
+		return limit
+	}
+	return defaultDomainRateLimit
+}
+
+// allowInbox : Respond 429 if bucket of key is empty, field is counted in statistics
+func allowInbox(writer http.ResponseWriter, key string, field string, limit state.RateLimit) bool {
+	if inboxLimiter == nil || limit.Rate <= 0 {
+		return true
+	}
+	allowed, wait, err := inboxLimiter.Allow(key, limit.Rate, limit.Burst)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+	relayState.RedisClient.HIncrBy("relay:statistics:ratelimit", field, 1)
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writer.WriteHeader(429)
+	writer.Write(nil)
+	return false
+}
+
+func anyRelayed(ids []string) bool {
+	for _, id := range ids {
+		if relayState.IsRelayed(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayStatus : Relay status activity through acceptance, filtering and deduplication
+func relayStatus(writer http.ResponseWriter, activity *activitypub.Activity, actor *activitypub.Actor, body []byte, keyID string) {
+	err := relayAcceptable(activity, actor)
+	if err == nil && (activity.Type == "Update" || activity.Type == "Delete") {
+		invalidateActor(activity, actor, keyID)
+	}
+	if err != nil {
+		writer.WriteHeader(400)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+
+	if !suitableRelay(activity, actor) {
+		fmt.Println("Skipping Relay Status : ", activity.Actor)
+	} else if activity.Type == "Undo" && !anyRelayed(activity.ObjectIDs()) {
+		// Undo of Announce, Like and others is meaningless for subscribers which never received original
+		fmt.Println("Skipping Relay Status : Undone activity is not relayed", activity.Actor)
+	} else if marked, err := relayState.MarkRelayed(activity.ID); err == nil && !marked {
+		fmt.Println("Skipping Relay Status : Already relayed", activity.Actor)
+	} else {
+		// Move is verified and recorded only when it is relayed, duplicated or skipped Move does not fetch target
+		if activity.Type == "Move" {
+			if err := verifyMove(activity); err != nil {
+				relayState.UnmarkRelayed(activity.ID)
+				fmt.Println("Reject Move : ", err.Error(), activity.Actor)
+				writer.WriteHeader(400)
+				writer.Write([]byte(err.Error()))
+				return
+			}
+			relayState.AddMigration(string(activity.Actor), string(activity.Target), activity.ID)
+		}
+		bodies, err := translateActivity(activity, body)
+		if err != nil {
+			relayState.UnmarkRelayed(activity.ID)
+			fmt.Println("Skipping Relay Status : ", err.Error(), activity.Actor)
+		} else {
+			var sourceDomain string
+			if domain, err := url.Parse(string(activity.Actor)); err == nil {
+				sourceDomain = domain.Host
+			}
+			for _, jsonData := range bodies {
+				go pushRelayJob(sourceDomain, jsonData)
+			}
+			fmt.Println("Accept Relay Status : ", activity.Actor)
+		}
+	}
+
+	writer.WriteHeader(202)
+	writer.Write(nil)
+}
+
 func handleInbox(writer http.ResponseWriter, request *http.Request, activityDecoder func(*http.Request) (*activitypub.Activity, *activitypub.Actor, []byte, error)) {
 	switch request.Method {
 	case "POST":
+		if !allowInbox(writer, "ip:"+clientIP(request), "ip", ipRateLimit) {
+			return
+		}
+		keyID := signatureKeyID(request)
 		activity, actor, body, err := activityDecoder(request)
-		if err != nil {
+		if err == errGoneActorDropped {
+			writer.WriteHeader(202)
+			writer.Write(nil)
+		} else if err == errBodyTooLarge {
+			writer.WriteHeader(413)
+			writer.Write(nil)
+		} else if err != nil {
 			writer.WriteHeader(400)
 			writer.Write(nil)
 		} else {
-			domain, _ := url.Parse(activity.Actor)
+			domain, err := url.Parse(string(activity.Actor))
+			if err != nil || domain.Host == "" {
+				writer.WriteHeader(400)
+				writer.Write([]byte("Actor should be URL"))
+				return
+			}
+			// Domain is charged after signature is verified, spoofed keyId does not drain bucket of other domain
+			if !allowInbox(writer, "domain:"+domain.Host, domain.Host, domainRateLimit(domain.Host)) {
+				return
+			}
 			switch activity.Type {
 			case "Follow":
 				err = followAcceptable(activity, actor)
 				if err != nil {
 					resp := activity.GenerateResponse(hostURL, "Reject")
-					jsonData, _ := json.Marshal(&resp)
+					jsonData := storeActivity(&resp, false)
 					go pushRegistorJob(actor.Inbox, jsonData)
+					relayState.AddAudit("server", state.AuditReject, domain.Host, err.Error())
 					fmt.Println("Reject Follow Request : ", err.Error(), activity.Actor)
 
 					writer.WriteHeader(202)
@@ -230,12 +533,12 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 								"activity_id": activity.ID,
 								"type":        "Follow",
 								"actor":       actor.ID,
-								"object":      activity.Object.(string),
+								"object":      activity.ObjectID(),
 							})
 							fmt.Println("Pending Follow Request : ", activity.Actor)
 						} else {
 							resp := activity.GenerateResponse(hostURL, "Accept")
-							jsonData, _ := json.Marshal(&resp)
+							jsonData := storeActivity(&resp, false)
 							go pushRegistorJob(actor.Inbox, jsonData)
 							relayState.AddSubscription(state.Subscription{
 								Domain:     domain.Host,
@@ -243,12 +546,14 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 								ActivityID: activity.ID,
 								ActorID:    actor.ID,
 							})
+							relayState.AddAudit("server", state.AuditAccept, domain.Host, "Follow request accepted automatically")
 							fmt.Println("Accept Follow Request : ", activity.Actor)
 						}
 					} else {
 						resp := activity.GenerateResponse(hostURL, "Reject")
-						jsonData, _ := json.Marshal(&resp)
+						jsonData := storeActivity(&resp, false)
 						go pushRegistorJob(actor.Inbox, jsonData)
+						relayState.AddAudit("server", state.AuditReject, domain.Host, "Domain is blocked")
 						fmt.Println("Reject Follow Request : ", activity.Actor)
 					}
 
@@ -256,8 +561,8 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 					writer.Write(nil)
 				}
 			case "Undo":
-				nestedActivity, _ := activity.NestedActivity()
-				if nestedActivity.Type == "Follow" && nestedActivity.Actor == activity.Actor {
+				nestedActivity, err := activity.NestedActivity()
+				if err == nil && nestedActivity.Type == "Follow" && nestedActivity.Actor == activity.Actor {
 					err = unFollowAcceptable(nestedActivity, actor)
 					if err != nil {
 						fmt.Println("Reject Unfollow Request : ", err.Error())
@@ -271,51 +576,33 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 						writer.Write(nil)
 					}
 				} else {
-					err = relayAcceptable(activity, actor)
-					if err != nil {
-						writer.WriteHeader(400)
-						writer.Write([]byte(err.Error()))
-					} else {
-						domain, _ := url.Parse(activity.Actor)
-						go pushRelayJob(domain.Host, body)
-						fmt.Println("Accept Relay Status : ", activity.Actor)
-
-						writer.WriteHeader(202)
-						writer.Write(nil)
-					}
+					relayStatus(writer, activity, actor, body, keyID)
 				}
 			case "Create", "Update", "Delete", "Announce", "Move":
-				err = relayAcceptable(activity, actor)
+				relayStatus(writer, activity, actor, body, keyID)
+			case "Flag":
+				err = reportAcceptable(activity, actor)
 				if err != nil {
+					fmt.Println("Reject Report : ", err.Error(), activity.Actor)
 					writer.WriteHeader(400)
 					writer.Write([]byte(err.Error()))
 				} else {
-					if suitableRelay(activity, actor) {
-						if relayState.RelayConfig.CreateAsAnnounce && activity.Type == "Create" {
-							nestedObject, err := activity.NestedActivity()
-							if err != nil {
-								fmt.Println("Fail Assert activity : activity.Actor")
-							}
-							switch nestedObject.Type {
-							case "Note":
-								resp := nestedObject.GenerateAnnounce(hostURL)
-								jsonData, _ := json.Marshal(&resp)
-								go pushRelayJob(domain.Host, jsonData)
-								fmt.Println("Accept Announce Note : ", activity.Actor)
-							default:
-								fmt.Println("Skipping Announce", nestedObject.Type, ": ", activity.Actor)
-							}
-						} else {
-							go pushRelayJob(domain.Host, body)
-							fmt.Println("Accept Relay Status : ", activity.Actor)
-						}
+					report, err := storeReport(activity, body)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						writer.WriteHeader(500)
+						writer.Write(nil)
 					} else {
-						fmt.Println("Skipping Relay Status : ", activity.Actor)
-					}
+						fmt.Println("Accept Report : ", report.ID, activity.Actor)
 
-					writer.WriteHeader(202)
-					writer.Write(nil)
+						writer.WriteHeader(202)
+						writer.Write(nil)
+					}
 				}
+			default:
+				fmt.Println("Ignore Activity : ", activity.Type, activity.Actor)
+				writer.WriteHeader(202)
+				writer.Write(nil)
 			}
 		}
 	default:
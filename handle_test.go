@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -12,6 +15,7 @@ import (
 	"testing"
 
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	ratelimit "github.com/yukimochi/Activity-Relay/RateLimit"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
 
@@ -411,7 +415,7 @@ func TestHandleInboxInvalidMethod(t *testing.T) {
 func TestHandleInboxValidFollow(t *testing.T) {
 	activity := mockActivity("Follow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -436,7 +440,7 @@ func TestHandleInboxValidFollow(t *testing.T) {
 func TestHandleInboxValidManuallyFollow(t *testing.T) {
 	activity := mockActivity("Follow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -469,7 +473,7 @@ func TestHandleInboxValidManuallyFollow(t *testing.T) {
 func TestHandleInboxInvalidFollow(t *testing.T) {
 	activity := mockActivity("Invalid-Follow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -495,7 +499,7 @@ func TestHandleInboxInvalidFollow(t *testing.T) {
 func TestHandleInboxValidFollowBlocked(t *testing.T) {
 	activity := mockActivity("Follow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -523,7 +527,7 @@ func TestHandleInboxValidFollowBlocked(t *testing.T) {
 func TestHandleInboxValidUnfollow(t *testing.T) {
 	activity := mockActivity("Unfollow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -553,7 +557,7 @@ func TestHandleInboxValidUnfollow(t *testing.T) {
 func TestHandleInboxInvalidUnfollow(t *testing.T) {
 	activity := mockActivity("Invalid-Unfollow")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -583,7 +587,7 @@ func TestHandleInboxInvalidUnfollow(t *testing.T) {
 func TestHandleInboxUnfollowAsActor(t *testing.T) {
 	activity := mockActivity("UnfollowAsActor")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -613,7 +617,7 @@ func TestHandleInboxUnfollowAsActor(t *testing.T) {
 func TestHandleInboxValidCreate(t *testing.T) {
 	activity := mockActivity("Create")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -646,7 +650,7 @@ func TestHandleInboxValidCreate(t *testing.T) {
 func TestHandleInboxlimitedCreate(t *testing.T) {
 	activity := mockActivity("Create")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -674,7 +678,7 @@ func TestHandleInboxlimitedCreate(t *testing.T) {
 func TestHandleInboxValidCreateAsAnnounceNote(t *testing.T) {
 	activity := mockActivity("Create")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -707,7 +711,7 @@ func TestHandleInboxValidCreateAsAnnounceNote(t *testing.T) {
 func TestHandleInboxValidCreateAsAnnounceNoNote(t *testing.T) {
 	activity := mockActivity("Create-Article")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -759,7 +763,7 @@ func TestHandleInboxUnsubscriptionCreate(t *testing.T) {
 func TestHandleInboxUndo(t *testing.T) {
 	activity := mockActivity("Undo")
 	actor := mockActor("Person")
-	domain, _ := url.Parse(activity.Actor)
+	domain, _ := url.Parse(string(activity.Actor))
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
 	}))
@@ -785,3 +789,824 @@ func TestHandleInboxUndo(t *testing.T) {
 	}
 	relayState.DelSubscription(domain.Host)
 }
+
+func TestHandleInboxUndoObjectID(t *testing.T) {
+	activity := mockActivity("Undo")
+	activity.Object = activitypub.LinkTo("https://mastodon.test.yukimochi.io/users/yukimochi/statuses/1/activity")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	relayState.DelSubscription(domain.Host)
+}
+
+func TestHandleInboxUndoRelayedOnly(t *testing.T) {
+	activity := mockActivity("Undo")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if relayState.IsRelayed(activity.ID) {
+		t.Fatalf("Failed - Undo of not relayed activity relayed.")
+	}
+
+	relayState.MarkRelayed(activity.ObjectID())
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if !relayState.IsRelayed(activity.ID) {
+		t.Fatalf("Failed - Undo of relayed activity not relayed.")
+	}
+
+	activity.ID = activity.ID + "/array"
+	activity.Object = activitypub.LinkTo("https://mastodon.test.yukimochi.io/users/yukimochi/statuses/2/activity", activity.ObjectID())
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if !relayState.IsRelayed(activity.ID) {
+		t.Fatalf("Failed - Undo of relayed activities in array not relayed.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleInboxUndoLimitedActor(t *testing.T) {
+	activity := mockActivity("Undo")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+	relayState.SetLimitedDomain(domain.Host, true)
+	relayState.MarkRelayed(activity.ObjectID())
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if relayState.IsRelayed(activity.ID) {
+		t.Fatalf("Failed - Undo of limited actor relayed.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleInboxDuplicateActivity(t *testing.T) {
+	activity := mockActivity("Create")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+	relayState.SetConfig(CreateAsAnnounce, true)
+	relayState.MarkRelayed(activity.ID)
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	nestedActivity, _ := activity.NestedActivity()
+	if _, _, err := relayState.SelectAnnounce(nestedActivity.ID); err == nil {
+		t.Fatalf("Failed - Duplicate activity relayed.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleInboxFlag(t *testing.T) {
+	actor := mockActor("Person")
+	activity := activitypub.Activity{
+		ID:     actor.ID + "#flags/1",
+		Actor:  activitypub.Link(actor.ID),
+		Type:   "Flag",
+		Object: activitypub.LinkTo("https://spam.example.com/users/spam", "https://spam.example.com/notes/1"),
+	}
+	domain, _ := url.Parse(actor.ID)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Failed - Flag from not subscriber accepted - " + strconv.Itoa(r.StatusCode))
+	}
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+	reportAction = "limit"
+	reportThreshold = 2
+	defer func() {
+		reportAction = ""
+		reportThreshold = 0
+	}()
+
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	reports, _ := relayState.ListReports("")
+	if len(reports) != 1 || reports[0].ID != activity.ID || reports[0].Domain != domain.Host || len(reports[0].Objects) != 2 {
+		t.Fatalf("Failed - Report not stored.")
+	}
+	if contains(relayState.LimitedDomains, "spam.example.com") {
+		t.Fatalf("Failed - Reported domain limited by single reporter.")
+	}
+
+	// Flag without ID
+	activity.ID = ""
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Failed - Flag without ID accepted - " + strconv.Itoa(r.StatusCode))
+	}
+
+	// Flag ID on other domain
+	activity.ID = "https://other.yukimochi.example.org/flags/1"
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Failed - Flag with ID on other domain accepted - " + strconv.Itoa(r.StatusCode))
+	}
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   "other.yukimochi.example.org",
+		InboxURL: "https://other.yukimochi.example.org/inbox",
+	})
+	activity.Actor = "https://other.yukimochi.example.org/actor"
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if !contains(relayState.LimitedDomains, "spam.example.com") {
+		t.Fatalf("Failed - Reported domain not limited.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleInboxFlagApproval(t *testing.T) {
+	actor := mockActor("Person")
+	activity := activitypub.Activity{
+		ID:     "https://other.yukimochi.example.org/flags/1",
+		Actor:  "https://other.yukimochi.example.org/actor",
+		Type:   "Flag",
+		Object: activitypub.LinkTo("https://spam.example.com/users/spam"),
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   "other.yukimochi.example.org",
+		InboxURL: "https://other.yukimochi.example.org/inbox",
+	})
+	relayState.AddReport(state.Report{ID: "1", Reporter: "https://a.example.com/actor", Domain: "a.example.com", Objects: []string{"https://spam.example.com/notes/1"}})
+	reportAction = "block"
+	reportThreshold = 2
+	reportApproval = true
+	defer func() {
+		reportAction = ""
+		reportThreshold = 0
+		reportApproval = false
+	}()
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	if contains(relayState.BlockedDomains, "spam.example.com") {
+		t.Fatalf("Failed - Reported domain blocked without approval.")
+	}
+	actions, _ := relayState.ListReportActions()
+	if len(actions) != 1 || actions[0].Domain != "spam.example.com" || actions[0].Action != "block" {
+		t.Fatalf("Failed - Report action not queued.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleInboxUnknownType(t *testing.T) {
+	actor := mockActor("Person")
+	activity := activitypub.Activity{
+		ID:     actor.ID + "#likes/1",
+		Actor:  activitypub.Link(actor.ID),
+		Type:   "Like",
+		Object: activitypub.LinkTo("https://example.com/notes/1"),
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+}
+
+func TestHandleInboxMove(t *testing.T) {
+	actor := mockActor("Person")
+	var aliases []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(w).Encode(activitypub.Actor{ID: "http://" + r.Host + r.URL.Path, Type: "Person", AlsoKnownAs: aliases})
+	}))
+	defer target.Close()
+	activity := activitypub.Activity{
+		ID:     actor.ID + "#moves/1",
+		Actor:  activitypub.Link(actor.ID),
+		Type:   "Move",
+		Object: activitypub.LinkTo(actor.ID),
+		Target: activitypub.Link(target.URL + "/users/new"),
+	}
+	domain, _ := url.Parse(actor.ID)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Failed - Move without alias accepted - " + strconv.Itoa(r.StatusCode))
+	}
+
+	aliases = []string{actor.ID}
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	migrations, _ := relayState.ListMigrations(actor.ID, "")
+	if len(migrations) != 1 || migrations[0].To != target.URL+"/users/new" {
+		t.Fatalf("Failed - Migration not recorded.")
+	}
+
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	migrations, _ = relayState.ListMigrations(actor.ID, "")
+	if len(migrations) != 1 {
+		t.Fatalf("Failed - Migration of duplicated Move recorded.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestHandleFollowersCountOnly(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleFollowers))
+	defer s.Close()
+
+	publicCollections = false
+	relayState.AddSubscription(state.Subscription{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+		ActorID:  "https://example.org/actor",
+	})
+	defer relayState.DelSubscription("example.org")
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.Header.Get("Content-Type") != "application/activity+json" {
+		t.Fatalf("Failed - Content-Type not match.")
+	}
+	defer r.Body.Close()
+	data, _ := ioutil.ReadAll(r.Body)
+	var collection activitypub.OrderedCollection
+	err = json.Unmarshal(data, &collection)
+	if err != nil {
+		t.Fatalf("Failed - Collection response is not valid.")
+	}
+	if collection.TotalItems != 1 || collection.First != "" || len(collection.OrderedItems) != 0 {
+		t.Fatalf("Failed - Collection exposes followers.")
+	}
+
+	r, err = http.Get(s.URL + "?page=1")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 404 {
+		t.Fatalf("Failed - StatusCode is not 404.")
+	}
+}
+
+func TestHandleFollowersPaging(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleFollowers))
+	defer s.Close()
+
+	publicCollections = true
+	defer func() { publicCollections = false }()
+	for i := 0; i < collectionPageSize+1; i++ {
+		domain := "example" + strconv.Itoa(i) + ".org"
+		relayState.AddSubscription(state.Subscription{
+			Domain:   domain,
+			InboxURL: "https://" + domain + "/inbox",
+			ActorID:  "https://" + domain + "/actor",
+		})
+		defer relayState.DelSubscription(domain)
+	}
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	defer r.Body.Close()
+	data, _ := ioutil.ReadAll(r.Body)
+	var collection activitypub.OrderedCollection
+	json.Unmarshal(data, &collection)
+	if collection.TotalItems != collectionPageSize+1 || collection.First != Actor.Followers+"?page=1" {
+		t.Fatalf("Failed - Collection is not paged.")
+	}
+
+	r, err = http.Get(s.URL + "?page=2")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	defer r.Body.Close()
+	data, _ = ioutil.ReadAll(r.Body)
+	var page activitypub.OrderedCollection
+	json.Unmarshal(data, &page)
+	if page.Type != "OrderedCollectionPage" || len(page.OrderedItems) != 1 || page.Next != "" || page.Prev != Actor.Followers+"?page=1" {
+		t.Fatalf("Failed - Last page is not valid.")
+	}
+
+	r, err = http.Get(s.URL + "?page=0")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Failed - StatusCode is not 400.")
+	}
+}
+
+func TestHandleOutbox(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleOutbox))
+	defer s.Close()
+
+	relayState.RedisClient.Del("relay:outbox", "relay:activities").Result()
+	announce := activitypub.Activity{
+		ID:   hostURL.String() + "/activities/announce",
+		Type: "Announce",
+	}
+	accept := activitypub.Activity{
+		ID:   hostURL.String() + "/activities/accept",
+		Type: "Accept",
+	}
+	storeActivity(&announce, true)
+	storeActivity(&accept, false)
+
+	r, err := http.Get(s.URL + "?page=1")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.Header.Get("Content-Type") != "application/activity+json" {
+		t.Fatalf("Failed - Content-Type not match.")
+	}
+	defer r.Body.Close()
+	data, _ := ioutil.ReadAll(r.Body)
+	var page activitypub.OrderedCollection
+	err = json.Unmarshal(data, &page)
+	if err != nil {
+		t.Fatalf("Failed - Outbox response is not valid.")
+	}
+	if page.TotalItems != 1 || len(page.OrderedItems) != 1 || page.OrderedItems[0].(map[string]interface{})["id"] != announce.ID {
+		t.Fatalf("Failed - Outbox lists non-public activity.")
+	}
+}
+
+func TestHandleActivityGet(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleActivity))
+	defer s.Close()
+
+	accept := activitypub.Activity{
+		ID:   hostURL.String() + "/activities/" + "dereference",
+		Type: "Accept",
+	}
+	storeActivity(&accept, false)
+
+	r, err := http.Get(s.URL + "/activities/dereference")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 200 {
+		t.Fatalf("Failed - StatusCode is not 200.")
+	}
+	defer r.Body.Close()
+	data, _ := ioutil.ReadAll(r.Body)
+	var activity activitypub.Activity
+	json.Unmarshal(data, &activity)
+	if activity.ID != accept.ID {
+		t.Fatalf("Failed - Activity is not valid.")
+	}
+
+	r, err = http.Get(s.URL + "/activities/notfound")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 404 {
+		t.Fatalf("Failed - StatusCode is not 404.")
+	}
+}
+
+func mockRemoteKey(actorID string) string {
+	keyID := actorID + "#main-key"
+	publicKey, _ := x509.MarshalPKIXPublicKey(&hostPrivatekey.PublicKey)
+	remoteActor := activitypub.Actor{
+		ID:        actorID,
+		PublicKey: activitypub.PublicKey{ID: keyID, PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))},
+	}
+	actorData, _ := json.Marshal(&remoteActor)
+	actorCache.Set(keyID, actorData)
+	return keyID
+}
+
+func mockSignedRequest(target string, actorID string) *http.Request {
+	keyID := mockRemoteKey(actorID)
+	req, _ := http.NewRequest("GET", target, nil)
+	key := activitypub.FetchKey{KeyID: keyID, PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	return req
+}
+
+func TestHandleActivityAuthorizedFetch(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleActivity))
+	defer s.Close()
+
+	authorizedFetch = true
+	defer func() { authorizedFetch = false }()
+	accept := activitypub.Activity{
+		ID:   hostURL.String() + "/activities/" + "authorized",
+		Type: "Accept",
+	}
+	storeActivity(&accept, false)
+
+	r, err := http.Get(s.URL + "/activities/authorized")
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 401 {
+		t.Fatalf("Failed - Unsigned request accepted.")
+	}
+
+	req := mockSignedRequest(s.URL+"/activities/authorized", "https://remote.yukimochi.example.org/actor")
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 200 {
+		t.Fatalf("Failed - Signed request rejected - " + strconv.Itoa(r.StatusCode))
+	}
+}
+
+func TestHandleActorAuthorizedFetch(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleActor))
+	defer s.Close()
+
+	authorizedFetch = true
+	defer func() { authorizedFetch = false }()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 401 {
+		t.Fatalf("Failed - Unsigned request accepted.")
+	}
+
+	r, err = http.DefaultClient.Do(mockSignedRequest(s.URL+"/actor", "https://remote.yukimochi.example.org/actor"))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 200 {
+		t.Fatalf("Failed - Signed request rejected - " + strconv.Itoa(r.StatusCode))
+	}
+
+	relayState.SetBlockedDomain("blocked.yukimochi.example.org", true)
+	defer relayState.SetBlockedDomain("blocked.yukimochi.example.org", false)
+	r, err = http.DefaultClient.Do(mockSignedRequest(s.URL+"/actor", "https://blocked.yukimochi.example.org/actor"))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 403 {
+		t.Fatalf("Failed - Blocked domain accepted - " + strconv.Itoa(r.StatusCode))
+	}
+}
+
+func TestHandleInboxUpdateActorInvalidatesCache(t *testing.T) {
+	actor := mockActor("Person")
+	activity := activitypub.Activity{
+		ID:     actor.ID + "#updates/1",
+		Actor:  activitypub.Link(actor.ID),
+		Type:   "Update",
+		Object: activitypub.Embed(map[string]interface{}{"id": actor.ID, "type": "Person"}),
+		To:     activitypub.Strings{"https://www.w3.org/ns/activitystreams#Public"},
+	}
+	domain, _ := url.Parse(actor.ID)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	actorCache.Set(actor.ID, []byte("{}"))
+	actorCache.Set(actor.PublicKey.ID, []byte("{}"))
+
+	// Not subscribed
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	key := activitypub.FetchKey{KeyID: actor.PublicKey.ID, PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	_, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if _, found := actorCache.Get(actor.ID); !found {
+		t.Fatalf("Failed - Actor invalidated by unacceptable activity.")
+	}
+
+	relayState.AddSubscription(state.Subscription{Domain: domain.Host})
+	defer relayState.DelSubscription(domain.Host)
+
+	// Signed by other actor
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	key = activitypub.FetchKey{KeyID: "https://other.yukimochi.example.org/actor#main-key", PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	relayState.UnmarkRelayed(activity.ID)
+	_, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if _, found := actorCache.Get(actor.ID); !found {
+		t.Fatalf("Failed - Actor invalidated by other signer.")
+	}
+
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	key = activitypub.FetchKey{KeyID: actor.PublicKey.ID, PrivateKey: hostPrivatekey}
+	key.SignRequest(req)
+	relayState.UnmarkRelayed(activity.ID)
+	_, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if _, found := actorCache.Get(actor.ID); found {
+		t.Fatalf("Failed - Updated actor remains in cache.")
+	}
+	if _, found := actorCache.Get(actor.PublicKey.ID); found {
+		t.Fatalf("Failed - Updated key remains in cache.")
+	}
+	relayState.UnmarkRelayed(activity.ID)
+}
+
+func TestHandleInboxTooLarge(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, decodeActivity)
+	}))
+	defer s.Close()
+
+	r, err := http.Post(s.URL, "application/activity+json", bytes.NewReader(make([]byte, DefaultMaxBodySize+1)))
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 413 {
+		t.Fatalf("Failed - StatusCode is not 413 - " + strconv.Itoa(r.StatusCode))
+	}
+}
+
+func TestHandleInboxRateLimitIP(t *testing.T) {
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	inboxLimiter = ratelimit.NewLimiter(relayState.RedisClient)
+	ipRateLimit = state.RateLimit{Rate: 0.01, Burst: 1}
+	defer func() { ipRateLimit = state.RateLimit{} }()
+
+	r, err := http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	r, err = http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 429 {
+		t.Fatalf("Failed - StatusCode is not 429 - " + strconv.Itoa(r.StatusCode))
+	}
+	if retry, _ := strconv.Atoi(r.Header.Get("Retry-After")); retry < 1 {
+		t.Fatalf("Failed - Retry-After is invalid - " + r.Header.Get("Retry-After"))
+	}
+	limited, _ := relayState.RedisClient.HGet("relay:statistics:ratelimit", "ip").Int()
+	if limited != 1 {
+		t.Fatalf("Failed - Rate limited request is not counted.")
+	}
+	relayState.DelSubscription(domain.Host)
+	relayState.RedisClient.FlushAll().Result()
+}
+
+func TestHandleInboxRateLimitDomain(t *testing.T) {
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(string(activity.Actor))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	inboxLimiter = ratelimit.NewLimiter(relayState.RedisClient)
+	relayState.SetRateLimit(domain.Host, state.RateLimit{Rate: 0.01, Burst: 1}, true)
+
+	r, err := http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Failed - StatusCode is not 202 - " + strconv.Itoa(r.StatusCode))
+	}
+	r, err = http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	if r.StatusCode != 429 {
+		t.Fatalf("Failed - StatusCode is not 429 - " + strconv.Itoa(r.StatusCode))
+	}
+	limited, _ := relayState.RedisClient.HGet("relay:statistics:ratelimit", domain.Host).Int()
+	if limited != 1 {
+		t.Fatalf("Failed - Rate limited request is not counted.")
+	}
+
+	relayState.SetRateLimit(domain.Host, state.RateLimit{}, false)
+	relayState.DelSubscription(domain.Host)
+	relayState.RedisClient.FlushAll().Result()
+}
+
+func TestHandleInboxRateLimitSpoofedKeyID(t *testing.T) {
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	inboxLimiter = ratelimit.NewLimiter(relayState.RedisClient)
+	relayState.SetRateLimit("other.yukimochi.example.org", state.RateLimit{Rate: 0.01, Burst: 1}, true)
+
+	key := activitypub.FetchKey{KeyID: "https://other.yukimochi.example.org/actor#main-key", PrivateKey: hostPrivatekey}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", s.URL, nil)
+		key.SignRequest(req)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed - " + err.Error())
+		}
+		if r.StatusCode == 429 {
+			t.Fatalf("Failed - Limited by domain of keyId.")
+		}
+	}
+	limited, _ := relayState.RedisClient.HGet("relay:statistics:ratelimit", "other.yukimochi.example.org").Int()
+	if limited != 0 {
+		t.Fatalf("Failed - Bucket of domain of keyId is charged.")
+	}
+
+	inboxLimiter = nil
+	relayState.RedisClient.FlushAll().Result()
+}
+
+func TestClientIP(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/inbox", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 192.0.2.1")
+	if clientIP(req) != "192.0.2.1" {
+		t.Fatalf("Failed - Untrusted header is used.")
+	}
+	realIPHeader = "X-Forwarded-For"
+	defer func() { realIPHeader = "" }()
+	if clientIP(req) != "198.51.100.1" {
+		t.Fatalf("Failed - Configured header is not used.")
+	}
+}
@@ -1,113 +1,191 @@
-package main
-
-import (
-	"crypto/rsa"
-	"fmt"
-	"net/http"
-	"net/url"
-	"time"
-
-	"github.com/RichardKnop/machinery/v1"
-	"github.com/RichardKnop/machinery/v1/config"
-	"github.com/go-redis/redis"
-	cache "github.com/patrickmn/go-cache"
-	"github.com/spf13/viper"
-	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
-	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
-	state "github.com/yukimochi/Activity-Relay/State"
-)
-
-var (
-	version string
-
-	// Actor : Relay's Actor
-	Actor activitypub.Actor
-
-	// WebfingerResource : Relay's Webfinger resource
-	WebfingerResource activitypub.WebfingerResource
-
-	// Nodeinfo : Relay's Nodeinfo
-	Nodeinfo activitypub.NodeinfoResources
-
-	hostURL         *url.URL
-	hostPrivatekey  *rsa.PrivateKey
-	relayState      state.RelayState
-	machineryServer *machinery.Server
-	actorCache      *cache.Cache
-)
-
-func initConfig() {
-	viper.SetConfigName("config")
-	viper.AddConfigPath(".")
-	err := viper.ReadInConfig()
-	if err != nil {
-		fmt.Println("Config file is not exists. Use environment variables.")
-		viper.BindEnv("actor_pem")
-		viper.BindEnv("redis_url")
-		viper.BindEnv("relay_bind")
-		viper.BindEnv("relay_domain")
-		viper.BindEnv("relay_servicename")
-	} else {
-		Actor.Summary = viper.GetString("relay_summary")
-		Actor.Icon = activitypub.Image{URL: viper.GetString("relay_icon")}
-		Actor.Image = activitypub.Image{URL: viper.GetString("relay_image")}
-	}
-	Actor.Name = viper.GetString("relay_servicename")
-
-	hostURL, _ = url.Parse("https://" + viper.GetString("relay_domain"))
-	hostPrivatekey, _ = keyloader.ReadPrivateKeyRSAfromPath(viper.GetString("actor_pem"))
-	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
-	if err != nil {
-		panic(err)
-	}
-	redisClient := redis.NewClient(redisOption)
-	relayState = state.NewState(redisClient, true)
-	relayState.ListenNotify(nil)
-	machineryConfig := &config.Config{
-		Broker:          viper.GetString("redis_url"),
-		DefaultQueue:    "relay",
-		ResultBackend:   viper.GetString("redis_url"),
-		ResultsExpireIn: 5,
-	}
-	machineryServer, err = machinery.NewServer(machineryConfig)
-	if err != nil {
-		panic(err)
-	}
-
-	Actor.GenerateSelfKey(hostURL, &hostPrivatekey.PublicKey)
-	actorCache = cache.New(5*time.Minute, 10*time.Minute)
-	WebfingerResource.GenerateFromActor(hostURL, &Actor)
-	Nodeinfo.GenerateFromActor(hostURL, &Actor, version)
-
-	fmt.Println("Welcome to YUKIMOCHI Activity-Relay [Server]", version)
-	fmt.Println(" - Configurations")
-	fmt.Println("RELAY DOMAIN : ", hostURL.Host)
-	fmt.Println("REDIS URL : ", viper.GetString("redis_url"))
-	fmt.Println("BIND ADDRESS : ", viper.GetString("relay_bind"))
-	fmt.Println(" - Blocked Domain")
-	domains, _ := redisClient.HKeys("relay:config:blockedDomain").Result()
-	for _, domain := range domains {
-		fmt.Println(domain)
-	}
-	fmt.Println(" - Limited Domain")
-	domains, _ = redisClient.HKeys("relay:config:limitedDomain").Result()
-	for _, domain := range domains {
-		fmt.Println(domain)
-	}
-}
-
-func main() {
-	// Load Config
-	initConfig()
-
-	http.HandleFunc("/.well-known/nodeinfo", handleNodeinfoLink)
-	http.HandleFunc("/.well-known/webfinger", handleWebfinger)
-	http.HandleFunc("/nodeinfo/2.1", handleNodeinfo)
-	http.HandleFunc("/actor", handleActor)
-	http.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
-		handleInbox(w, r, decodeActivity)
-	})
-	http.HandleFunc("/", HandleIndex)
-	go updateWebInfo()
-	http.ListenAndServe(viper.GetString("relay_bind"), nil)
-}
+package main
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/RichardKnop/machinery/v1"
+	"github.com/RichardKnop/machinery/v1/config"
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
+	ratelimit "github.com/yukimochi/Activity-Relay/RateLimit"
+	state "github.com/yukimochi/Activity-Relay/State"
+	transport "github.com/yukimochi/Activity-Relay/Transport"
+)
+
+var (
+	version string
+
+	// Actor : Relay's Actor
+	Actor activitypub.Actor
+
+	// WebfingerResource : Relay's Webfinger resource
+	WebfingerResource activitypub.WebfingerResource
+
+	// Nodeinfo : Relay's Nodeinfo
+	Nodeinfo activitypub.NodeinfoResources
+
+	hostURL         *url.URL
+	hostPrivatekey  *rsa.PrivateKey
+	relayState      state.RelayState
+	machineryServer *machinery.Server
+	actorCache      *activitypub.ActorCache
+	fetchKey        *activitypub.FetchKey
+
+	publicCollections bool
+	authorizedFetch   bool
+	goneActorDelete   string
+	maxBodySize       int64
+
+	inboxLimiter           *ratelimit.Limiter
+	defaultDomainRateLimit state.RateLimit
+	ipRateLimit            state.RateLimit
+	realIPHeader           string
+
+	reportAction    string
+	reportThreshold int
+	reportApproval  bool
+)
+
+func initConfig() {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		fmt.Println("Config file is not exists. Use environment variables.")
+		viper.BindEnv("actor_pem")
+		viper.BindEnv("redis_url")
+		viper.BindEnv("relay_bind")
+		viper.BindEnv("relay_domain")
+		viper.BindEnv("relay_servicename")
+		viper.BindEnv("public_collections")
+		viper.BindEnv("outbox_size")
+		viper.BindEnv("activity_ttl")
+		viper.BindEnv("audit_size")
+		viper.BindEnv("migration_size")
+		viper.BindEnv("authorized_fetch")
+		viper.BindEnv("actor_cache_size")
+		viper.BindEnv("actor_cache_ttl")
+		viper.BindEnv("gone_actor_ttl")
+		viper.BindEnv("gone_actor_delete")
+		viper.BindEnv("max_body_size")
+		viper.BindEnv("ratelimit_domain_rate")
+		viper.BindEnv("ratelimit_domain_burst")
+		viper.BindEnv("ratelimit_ip_rate")
+		viper.BindEnv("ratelimit_ip_burst")
+		viper.BindEnv("real_ip_header")
+		viper.BindEnv("announce_types")
+		viper.BindEnv("announce_ttl")
+		viper.BindEnv("relayed_ttl")
+		viper.BindEnv("report_action")
+		viper.BindEnv("report_threshold")
+		viper.BindEnv("report_approval")
+		for _, key := range transport.ConfigKeys {
+			viper.BindEnv(key)
+		}
+	} else {
+		Actor.Summary = viper.GetString("relay_summary")
+		Actor.Icon = activitypub.Image{URL: viper.GetString("relay_icon")}
+		Actor.Image = activitypub.Image{URL: viper.GetString("relay_image")}
+	}
+	Actor.Name = viper.GetString("relay_servicename")
+	publicCollections = viper.GetBool("public_collections")
+	authorizedFetch = viper.GetBool("authorized_fetch")
+	goneActorDelete = viper.GetString("gone_actor_delete")
+	maxBodySize = viper.GetInt64("max_body_size")
+	defaultDomainRateLimit = state.RateLimit{Rate: viper.GetFloat64("ratelimit_domain_rate"), Burst: viper.GetInt("ratelimit_domain_burst")}
+	ipRateLimit = state.RateLimit{Rate: viper.GetFloat64("ratelimit_ip_rate"), Burst: viper.GetInt("ratelimit_ip_burst")}
+	realIPHeader = viper.GetString("real_ip_header")
+	reportAction = viper.GetString("report_action")
+	reportThreshold = viper.GetInt("report_threshold")
+	reportApproval = viper.GetBool("report_approval")
+	setAnnounceTypes(viper.GetStringSlice("announce_types"))
+
+	hostURL, _ = url.Parse("https://" + viper.GetString("relay_domain"))
+	hostPrivatekey, _ = keyloader.ReadPrivateKeyRSAfromPath(viper.GetString("actor_pem"))
+	redisOption, err := redis.ParseURL(viper.GetString("redis_url"))
+	if err != nil {
+		panic(err)
+	}
+	redisClient := redis.NewClient(redisOption)
+	relayState = state.NewState(redisClient, true)
+	relayState.ActivityLimit = viper.GetInt("outbox_size")
+	relayState.ActivityTTL = viper.GetDuration("activity_ttl")
+	relayState.AuditLogSize = viper.GetInt("audit_size")
+	relayState.MigrationLogSize = viper.GetInt("migration_size")
+	relayState.AnnounceTTL = viper.GetDuration("announce_ttl")
+	relayState.RelayedTTL = viper.GetDuration("relayed_ttl")
+	relayState.ListenNotify(nil)
+	inboxLimiter = ratelimit.NewLimiter(redisClient)
+	machineryConfig := &config.Config{
+		Broker:          viper.GetString("redis_url"),
+		DefaultQueue:    "relay",
+		ResultBackend:   viper.GetString("redis_url"),
+		ResultsExpireIn: 5,
+	}
+	machineryServer, err = machinery.NewServer(machineryConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	activitypub.HTTPClient, err = transport.NewClient(transport.LoadConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	Actor.GenerateSelfKey(hostURL, &hostPrivatekey.PublicKey)
+	fetchKey = &activitypub.FetchKey{KeyID: Actor.PublicKey.ID, PrivateKey: hostPrivatekey}
+	actorCacheTTL := viper.GetDuration("actor_cache_ttl")
+	if actorCacheTTL == 0 {
+		actorCacheTTL = time.Hour
+	}
+	actorCacheSize := viper.GetInt("actor_cache_size")
+	if actorCacheSize == 0 {
+		actorCacheSize = 1000
+	}
+	actorCache = activitypub.NewActorCache(redisClient, actorCacheSize, actorCacheTTL)
+	actorCache.GoneTTL = viper.GetDuration("gone_actor_ttl")
+	WebfingerResource.GenerateFromActor(hostURL, &Actor)
+	Nodeinfo.GenerateFromActor(hostURL, &Actor, version)
+
+	fmt.Println("Welcome to YUKIMOCHI Activity-Relay [Server]", version)
+	fmt.Println(" - Configurations")
+	fmt.Println("RELAY DOMAIN : ", hostURL.Host)
+	fmt.Println("REDIS URL : ", viper.GetString("redis_url"))
+	fmt.Println("BIND ADDRESS : ", viper.GetString("relay_bind"))
+	fmt.Println(" - Blocked Domain")
+	domains, _ := redisClient.HKeys("relay:config:blockedDomain").Result()
+	for _, domain := range domains {
+		fmt.Println(domain)
+	}
+	fmt.Println(" - Limited Domain")
+	domains, _ = redisClient.HKeys("relay:config:limitedDomain").Result()
+	for _, domain := range domains {
+		fmt.Println(domain)
+	}
+}
+
+func main() {
+	// Load Config
+	initConfig()
+
+	http.HandleFunc("/.well-known/nodeinfo", handleNodeinfoLink)
+	http.HandleFunc("/.well-known/webfinger", handleWebfinger)
+	http.HandleFunc("/nodeinfo/2.1", handleNodeinfo)
+	http.HandleFunc("/actor", handleActor)
+	http.HandleFunc("/actor/followers", handleFollowers)
+	http.HandleFunc("/actor/following", handleFollowing)
+	http.HandleFunc("/outbox", handleOutbox)
+	http.HandleFunc("/activities/", handleActivity)
+	http.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, decodeActivity)
+	})
+	http.HandleFunc("/", HandleIndex)
+	go updateWebInfo()
+	http.ListenAndServe(viper.GetString("relay_bind"), nil)
+}
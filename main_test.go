@@ -11,6 +11,7 @@ import (
 func TestMain(m *testing.M) {
 	viper.Set("actor_pem", "misc/testKey.pem")
 	viper.Set("relay_domain", "relay.yukimochi.example.org")
+	viper.Set("http_allowlist", []string{"127.0.0.0/8"})
 	initConfig()
 	relayState = state.NewState(relayState.RedisClient, false)
 
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	state "github.com/yukimochi/Activity-Relay/State"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Properties of ActivityStreams vocabulary, other properties are extension and dropped if exceeding MaxExtensionSize
+var vocabularyProperties = map[string]bool{
+	"@context": true, "id": true, "type": true, "actor": true, "object": true, "target": true,
+	"result": true, "origin": true, "instrument": true, "to": true, "cc": true, "audience": true,
+	"attributedTo": true, "attachment": true, "content": true, "contentMap": true, "name": true,
+	"nameMap": true, "summary": true, "summaryMap": true, "published": true, "updated": true,
+	"startTime": true, "endTime": true, "duration": true, "url": true, "tag": true, "inReplyTo": true,
+	"replies": true, "generator": true, "icon": true, "image": true, "location": true, "preview": true,
+	"context": true, "mediaType": true, "href": true, "rel": true, "oneOf": true, "anyOf": true,
+	"closed": true, "formerType": true, "deleted": true, "sensitive": true,
+}
+
+// Elements kept by sanitizer, other elements are unwrapped to their children
+var allowedElements = map[atom.Atom]bool{
+	atom.P: true, atom.Br: true, atom.A: true, atom.Span: true, atom.Strong: true, atom.B: true,
+	atom.Em: true, atom.I: true, atom.U: true, atom.Del: true, atom.S: true, atom.Code: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+}
+
+// Elements dropped with their children by sanitizer
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Form: true, atom.Template: true, atom.Noscript: true, atom.Title: true, atom.Svg: true, atom.Math: true,
+}
+
+// Microformats classes used by mentions and hashtags
+var allowedClasses = map[string]bool{
+	"h-card": true, "u-url": true, "mention": true, "hashtag": true, "invisible": true, "ellipsis": true,
+}
+
+// relayBodies : Body relayed to subscribers, normalized once for each normalization
+type relayBodies struct {
+	body       []byte
+	normalized map[state.Normalization][]byte
+	errors     map[state.Normalization]error
+}
+
+func newRelayBodies(body []byte) *relayBodies {
+	return &relayBodies{
+		body:       body,
+		normalized: map[state.Normalization][]byte{},
+		errors:     map[state.Normalization]error{},
+	}
+}
+
+// bodyFor : Body relayed to subscriber, error means activity is not relayed to subscriber
+func (bodies *relayBodies) bodyFor(subscription state.Subscription) ([]byte, error) {
+	if subscription.Normalization == nil {
+		return bodies.body, nil
+	}
+	normalization := *subscription.Normalization
+	if err, ok := bodies.errors[normalization]; ok {
+		return nil, err
+	}
+	if jsonData, ok := bodies.normalized[normalization]; ok {
+		return jsonData, nil
+	}
+	jsonData, err := normalizeActivity(bodies.body, normalization)
+	if err != nil {
+		bodies.errors[normalization] = err
+		return nil, err
+	}
+	bodies.normalized[normalization] = jsonData
+	return jsonData, nil
+}
+
+// normalizeActivity : Normalize body relayed to subscriber, error means activity is not relayed to subscriber
+func normalizeActivity(body []byte, normalization state.Normalization) ([]byte, error) {
+	var activity map[string]interface{}
+	err := json.Unmarshal(body, &activity)
+	if err != nil {
+		return nil, err
+	}
+	// Origin's Linked Data Signature is broken by normalization, delivery is signed by relay
+	delete(activity, "signature")
+	err = normalizeObject(activity, normalization)
+	if err != nil {
+		return nil, err
+	}
+	if object, ok := activity["object"].(map[string]interface{}); ok {
+		err = normalizeObject(object, normalization)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(activity)
+}
+
+func normalizeObject(object map[string]interface{}, normalization state.Normalization) error {
+	if normalization.MaxAttachments > 0 && countValues(object["attachment"]) > normalization.MaxAttachments {
+		return errors.New("Too many attachments")
+	}
+	if normalization.MaxTags > 0 && countValues(object["tag"]) > normalization.MaxTags {
+		return errors.New("Too many tags")
+	}
+	delete(object, "bto")
+	delete(object, "bcc")
+	if normalization.MaxExtensionSize > 0 {
+		for property, value := range object {
+			if vocabularyProperties[property] {
+				continue
+			}
+			jsonData, _ := json.Marshal(value)
+			if len(jsonData) > normalization.MaxExtensionSize {
+				delete(object, property)
+			}
+		}
+	}
+	if normalization.SanitizeHTML {
+		for _, property := range []string{"content", "summary"} {
+			if content, ok := object[property].(string); ok {
+				object[property] = sanitizeHTML(content)
+			}
+			if contentMap, ok := object[property+"Map"].(map[string]interface{}); ok {
+				for language, value := range contentMap {
+					if content, ok := value.(string); ok {
+						contentMap[language] = sanitizeHTML(content)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func countValues(value interface{}) int {
+	switch value := value.(type) {
+	case nil:
+		return 0
+	case []interface{}:
+		return len(value)
+	}
+	return 1
+}
+
+// sanitizeHTML : Reduce HTML to safe subset of elements, links and microformats classes
+func sanitizeHTML(content string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return html.EscapeString(content)
+	}
+	var builder strings.Builder
+	for _, node := range nodes {
+		writeSanitized(&builder, node)
+	}
+	return builder.String()
+}
+
+func writeSanitized(builder *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		builder.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if droppedElements[node.DataAtom] {
+		return
+	}
+	allowed := allowedElements[node.DataAtom]
+	if allowed {
+		builder.WriteString("<" + node.Data)
+		for _, attribute := range node.Attr {
+			if value, ok := sanitizeAttribute(node.DataAtom, attribute); ok {
+				builder.WriteString(fmt.Sprintf(" %s=\"%s\"", attribute.Key, html.EscapeString(value)))
+			}
+		}
+		builder.WriteString(">")
+		if node.DataAtom == atom.Br {
+			return
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeSanitized(builder, child)
+	}
+	if allowed {
+		builder.WriteString("</" + node.Data + ">")
+	}
+}
+
+func sanitizeAttribute(element atom.Atom, attribute html.Attribute) (string, bool) {
+	if attribute.Namespace != "" {
+		return "", false
+	}
+	switch attribute.Key {
+	case "href":
+		href := strings.ToLower(strings.TrimSpace(attribute.Val))
+		if element == atom.A && (strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://")) {
+			return attribute.Val, true
+		}
+	case "rel":
+		if element == atom.A {
+			return attribute.Val, true
+		}
+	case "class":
+		var classes []string
+		for _, class := range strings.Fields(attribute.Val) {
+			if allowedClasses[class] {
+				classes = append(classes, class)
+			}
+		}
+		if len(classes) > 0 {
+			return strings.Join(classes, " "), true
+		}
+	}
+	return "", false
+}
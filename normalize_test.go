@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	content := `<p onclick="alert(1)"><span class="h-card evil"><a href="https://example.com/@example" class="u-url mention" style="x">@example</a></span> <a href="javascript:alert(1)">link</a><script>alert(1)</script><img src="https://example.com/a.png">text<br>&lt;b&gt;</p>`
+	sanitized := sanitizeHTML(content)
+	valid := `<p><span class="h-card"><a href="https://example.com/@example" class="u-url mention">@example</a></span> <a>link</a>text<br>&lt;b&gt;</p>`
+	if sanitized != valid {
+		t.Fatalf("Failed - Invalid sanitized HTML : " + sanitized)
+	}
+}
+
+func TestNormalizeActivity(t *testing.T) {
+	body := []byte(`{
+		"id": "https://example.com/activities/1",
+		"type": "Create",
+		"bcc": ["https://example.com/users/secret"],
+		"signature": {"type": "RsaSignature2017"},
+		"object": {
+			"id": "https://example.com/notes/1",
+			"type": "Note",
+			"content": "<p>note<script>alert(1)</script></p>",
+			"bto": ["https://example.com/users/secret"],
+			"atomUri": "https://example.com/notes/1",
+			"_misskey_content": "` + strings.Repeat("a", 64) + `",
+			"tag": [{"type": "Hashtag"}, {"type": "Hashtag"}]
+		}
+	}`)
+	normalized, err := normalizeActivity(body, state.Normalization{SanitizeHTML: true, MaxExtensionSize: 60})
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	var activity map[string]interface{}
+	json.Unmarshal(normalized, &activity)
+	object := activity["object"].(map[string]interface{})
+	if activity["bcc"] != nil || activity["signature"] != nil || object["bto"] != nil {
+		t.Fatalf("Failed - bto, bcc or signature not removed.")
+	}
+	if object["_misskey_content"] != nil || object["atomUri"] == nil {
+		t.Fatalf("Failed - Extension property not dropped by size.")
+	}
+	if object["content"] != "<p>note</p>" {
+		t.Fatalf("Failed - Content not sanitized.")
+	}
+
+	_, err = normalizeActivity(body, state.Normalization{MaxTags: 1})
+	if err == nil {
+		t.Fatalf("Failed - Object exceeding max tags normalized.")
+	}
+}
+
+func TestRelayBodies(t *testing.T) {
+	body := []byte(`{"type": "Create", "object": {"type": "Note", "attachment": [{}, {}]}}`)
+	bodies := newRelayBodies(body)
+
+	jsonData, err := bodies.bodyFor(state.Subscription{Domain: "a.example.com"})
+	if err != nil || string(jsonData) != string(body) {
+		t.Fatalf("Failed - Body modified without normalization.")
+	}
+	_, err = bodies.bodyFor(state.Subscription{Domain: "b.example.com", Normalization: &state.Normalization{MaxAttachments: 1}})
+	if err == nil {
+		t.Fatalf("Failed - Object exceeding max attachments relayed.")
+	}
+	jsonData, err = bodies.bodyFor(state.Subscription{Domain: "c.example.com", Normalization: &state.Normalization{MaxAttachments: 2}})
+	if err != nil || string(jsonData) == string(body) {
+		t.Fatalf("Failed - Body not normalized.")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	state "github.com/yukimochi/Activity-Relay/State"
+)
+
+// DefaultReportThreshold : Number of reporter domains to take report_action when report_threshold is not set
+const DefaultReportThreshold = 3
+
+// reportAcceptable : Flag is accepted only from subscribers, with ID on domain of actor
+func reportAcceptable(activity *activitypub.Activity, actor *activitypub.Actor) error {
+	domain, err := url.Parse(string(activity.Actor))
+	if err != nil || !contains(relayState.Subscriptions, domain.Host) {
+		return errors.New("Flag only accepted from subscribers")
+	}
+	flagID, err := url.Parse(activity.ID)
+	if err != nil || flagID.Host == "" || flagID.Host != domain.Host {
+		return errors.New("Flag ID should be on domain of actor")
+	}
+	if len(activity.ObjectIDs()) == 0 {
+		return errors.New("Flag should contain reported object")
+	}
+	return nil
+}
+
+// storeReport : Store Flag to reports queue and take configured action to reported domains reported by enough domains
+func storeReport(activity *activitypub.Activity, body []byte) (*state.Report, error) {
+	var flag struct {
+		Content string `json:"content"`
+	}
+	json.Unmarshal(body, &flag)
+	domain, err := url.Parse(string(activity.Actor))
+	if err != nil {
+		return nil, err
+	}
+	report := state.Report{
+		ID:       activity.ID,
+		Reporter: string(activity.Actor),
+		Domain:   domain.Host,
+		Objects:  activity.ObjectIDs(),
+		Content:  flag.Content,
+	}
+	err = relayState.AddReport(report)
+	if err != nil {
+		return nil, err
+	}
+	for _, reported := range report.ReportedDomains() {
+		takeReportAction(reported)
+	}
+	return &report, nil
+}
+
+// reporterDomains : Domains of unresolved reports on reported domain, except itself
+func reporterDomains(reported string) []string {
+	reports, err := relayState.ListReports(reported)
+	if err != nil {
+		return nil
+	}
+	var reporters []string
+	for _, report := range reports {
+		if report.Domain != reported && !contains(reporters, report.Domain) && contains(report.ReportedDomains(), reported) {
+			reporters = append(reporters, report.Domain)
+		}
+	}
+	return reporters
+}
+
+// takeReportAction : Limit or block reported domain by report_action when reported by report_threshold domains, action is queued for relay admin with report_approval
+func takeReportAction(reported string) {
+	if reported == hostURL.Host || (reportAction != "limit" && reportAction != "block") {
+		return
+	}
+	threshold := reportThreshold
+	if threshold <= 0 {
+		threshold = DefaultReportThreshold
+	}
+	reporters := reporterDomains(reported)
+	if len(reporters) < threshold {
+		return
+	}
+	if contains(relayState.BlockedDomains, reported) || (reportAction == "limit" && contains(relayState.LimitedDomains, reported)) {
+		return
+	}
+	reason := "Reported by " + strings.Join(reporters, ", ")
+	if reportApproval {
+		err := relayState.QueueReportAction(state.ReportAction{Domain: reported, Action: reportAction, Reason: reason})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Println("Queue Report Action : ", reportAction, reported)
+		return
+	}
+	switch reportAction {
+	case "limit":
+		relayState.SetLimitedDomain(reported, true)
+		relayState.AddAudit("server", state.AuditLimit, reported, reason)
+		fmt.Println("Limit Reported Domain : ", reported)
+	case "block":
+		relayState.SetBlockedDomain(reported, true)
+		relayState.AddAudit("server", state.AuditBlock, reported, reason)
+		fmt.Println("Block Reported Domain : ", reported)
+	}
+}
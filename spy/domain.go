@@ -3,10 +3,11 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"net/http"
+	"html"
 	"strings"
+	"time"
 
+	uuid "github.com/satori/go.uuid"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
@@ -24,77 +25,72 @@ func GetDomainList() ([]string, error) {
 	return lists, nil
 }
 
-type GetNodeInfo struct {
-	Rel  string `json:"rel"`
-	Href string `json:"href"`
-}
-
-func CheckInstanceNum(domain string, byTotal bool) int {
-	var nodes map[string][]GetNodeInfo
-	var nodeinfo map[string]interface{}
-	getNodeInfoUrl := "https://" + domain + "/.well-known/nodeinfo"
-	resp, err := http.Get(getNodeInfoUrl)
-	if err != nil {
-		return -1
-	}
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -2
-	}
-	err = json.Unmarshal(data, &nodes)
-	if err != nil {
-		return -3
-	}
-	links, ok := nodes["links"]
-	if !ok || len(links) < 1 {
-		return -4
-	}
-	nodeInfoUrl := links[0].Href
-	resp, err = http.Get(nodeInfoUrl)
-	if err != nil {
-		return -5
-	}
-	data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return -6
-	}
-	err = json.Unmarshal(data, &nodeinfo)
-	if err != nil {
-		return -7
-	}
-	usage, ok := nodeinfo["usage"]
-	if !ok {
-		return -8
-	}
-	users := (usage.(map[string]interface{})["users"]).(map[string]interface{})
-	if byTotal {
-		return int(users["total"].(float64))
-	}
-	return int(users["activeMonth"].(float64))
-}
-
 func createUnfollowRequestResponse(subscription state.Subscription) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:      subscription.ActivityID,
-		Actor:   subscription.ActorID,
+		Actor:   activitypub.Link(subscription.ActorID),
 		Type:    "Follow",
-		Object:  "https://www.w3.org/ns/activitystreams#Public",
+		Object:  activitypub.LinkTo("https://www.w3.org/ns/activitystreams#Public"),
 	}
 
 	resp := activity.GenerateResponse(hostname, "Reject")
 	jsonData, _ := json.Marshal(&resp)
+	relayState.AddActivity(resp.ID, jsonData, false)
 	pushRegistorJob(subscription.InboxURL, jsonData)
 
 	return nil
 }
 
-func unfollowDomains(domain string) error {
+func createWarningNote(subscription state.Subscription, reason string) activitypub.Activity {
+	note := activitypub.ActivityObject{
+		ID:           hostname.String() + "/activities/" + uuid.NewV4().String(),
+		Type:         "Note",
+		AttributedTo: activitypub.Link(hostname.String() + "/actor"),
+		Published:    time.Now().UTC().Format(time.RFC3339),
+		Content:      "<p><span class=\"h-card\"><a href=\"" + html.EscapeString(subscription.ActorID) + "\" class=\"u-url mention\">@" + html.EscapeString(subscription.Domain) + "</a></span> " + html.EscapeString(conf.warningMsg) + "</p><p>" + html.EscapeString(reason) + "</p>",
+		To:           []string{subscription.ActorID},
+		Tag: []activitypub.Tag{
+			{
+				Type: "Mention",
+				Href: subscription.ActorID,
+				Name: "@" + subscription.Domain,
+			},
+		},
+	}
+	return activitypub.Activity{
+		Context: []string{"https://www.w3.org/ns/activitystreams"},
+		ID:      hostname.String() + "/activities/" + uuid.NewV4().String(),
+		Actor:   activitypub.Link(hostname.String() + "/actor"),
+		Type:    "Create",
+		Object:  activitypub.Embed(&note),
+		To:      []string{subscription.ActorID},
+	}
+}
+
+func warnSubscriber(domain string, reason string) error {
+	subscription := relayState.SelectSubscription(domain)
+	if subscription == nil {
+		return errors.New("Invalid domain [" + domain + "] given")
+	}
+	activity := createWarningNote(*subscription, reason)
+	jsonData, err := json.Marshal(&activity)
+	if err != nil {
+		return err
+	}
+	relayState.AddActivity(activity.ID, jsonData, false)
+	relayState.AddActivity(activity.ObjectID(), activity.Object[0].Embedded, false)
+	pushRegistorJob(subscription.InboxURL, jsonData)
+	return nil
+}
+
+func unfollowDomains(domain string, reason string) error {
 	subscriptions := relayState.Subscriptions
 	if contains(subscriptions, domain) {
 		subscription := *relayState.SelectSubscription(domain)
 		createUnfollowRequestResponse(subscription)
 		relayState.DelSubscription(subscription.Domain)
+		relayState.AddAudit("spy", state.AuditKick, subscription.Domain, reason)
 		return nil
 	}
 	return errors.New("Invalid domain [" + domain + "] given")
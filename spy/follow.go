@@ -10,13 +10,15 @@ import (
 	"github.com/RichardKnop/machinery/v1/tasks"
 	uuid "github.com/satori/go.uuid"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+	queue "github.com/yukimochi/Activity-Relay/Queue"
 	state "github.com/yukimochi/Activity-Relay/State"
 )
 
 func pushRegistorJob(inboxURL string, body []byte) {
 	job := &tasks.Signature{
 		Name:       "registor",
-		RetryCount: 25,
+		RetryCount: queue.RegistorRetryCount,
+		Headers:    queue.NewHeaders(),
 		Args: []tasks.Arg{
 			{
 				Name:  "inboxURL",
@@ -44,9 +46,9 @@ func createFollowRequestResponse(domain string, response string) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:      data["activity_id"],
-		Actor:   data["actor"],
+		Actor:   activitypub.Link(data["actor"]),
 		Type:    data["type"],
-		Object:  data["object"],
+		Object:  activitypub.LinkTo(data["object"]),
 	}
 
 	resp := activity.GenerateResponse(hostname, response)
@@ -54,6 +56,7 @@ func createFollowRequestResponse(domain string, response string) error {
 	if err != nil {
 		return err
 	}
+	relayState.AddActivity(resp.ID, jsonData, false)
 	pushRegistorJob(data["inbox_url"], jsonData)
 	relayState.RedisClient.Del("relay:pending:" + domain)
 	if response == "Accept" {
@@ -68,21 +71,24 @@ func createFollowRequestResponse(domain string, response string) error {
 	return nil
 }
 
-func createUpdateActorActivity(subscription state.Subscription) error {
+func createUpdateActorActivity(subscriptions []state.Subscription) error {
 	activity := activitypub.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams"},
 		ID:      hostname.String() + "/activities/" + uuid.NewV4().String(),
-		Actor:   hostname.String() + "/actor",
+		Actor:   activitypub.Link(hostname.String() + "/actor"),
 		Type:    "Update",
 		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
-		Object:  Actor,
+		Object:  activitypub.Embed(&Actor),
 	}
 
 	jsonData, err := json.Marshal(&activity)
 	if err != nil {
 		return err
 	}
-	pushRegistorJob(subscription.InboxURL, jsonData)
+	relayState.AddActivity(activity.ID, jsonData, true)
+	for _, subscription := range subscriptions {
+		pushRegistorJob(subscription.InboxURL, jsonData)
+	}
 
 	return nil
 }
@@ -99,7 +105,7 @@ func listFollows() ([]string, error) {
 	return domains, nil
 }
 
-func acceptFollow(domain string) error {
+func acceptFollow(domain string, reason string) error {
 	var err error
 	var domains []string
 	follows, err := relayState.RedisClient.Keys("relay:pending:*").Result()
@@ -111,15 +117,14 @@ func acceptFollow(domain string) error {
 	}
 	if contains(domains, domain) {
 		createFollowRequestResponse(domain, "Accept")
+		relayState.AddAudit("spy", state.AuditAccept, domain, reason)
 		return nil
 	} else {
 		return errors.New("Invalid domain [" + domain + "] given")
 	}
-
-	return nil
 }
 
-func rejectFollow(domain string) error {
+func rejectFollow(domain string, reason string) error {
 	var err error
 	var domains []string
 	follows, err := relayState.RedisClient.Keys("relay:pending:*").Result()
@@ -132,6 +137,7 @@ func rejectFollow(domain string) error {
 	for _, request := range domains {
 		if domain == request {
 			createFollowRequestResponse(domain, "Reject")
+			relayState.AddAudit("spy", state.AuditReject, domain, reason)
 			return nil
 		}
 	}
@@ -139,11 +145,9 @@ func rejectFollow(domain string) error {
 }
 
 func updateActor() error {
-	for _, subscription := range relayState.Subscriptions {
-		err := createUpdateActorActivity(subscription)
-		if err != nil {
-			return errors.New("Failed Update Actor for " + subscription.Domain)
-		}
+	err := createUpdateActorActivity(relayState.Subscriptions)
+	if err != nil {
+		return errors.New("Failed Update Actor")
 	}
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rsa"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -15,7 +16,10 @@ import (
 	"github.com/spf13/viper"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
 	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
+	nodeinfo "github.com/yukimochi/Activity-Relay/Nodeinfo"
+	policy "github.com/yukimochi/Activity-Relay/Policy"
 	state "github.com/yukimochi/Activity-Relay/State"
+	transport "github.com/yukimochi/Activity-Relay/Transport"
 )
 
 const (
@@ -25,17 +29,13 @@ const (
 )
 
 type configs struct {
-	allowMaxUser  int
-	allowMinUser  int
-	kickMaxUser   int
-	kickMinUser   int
-	maxInstances  int
-	permitMode    bool
-	whitelistMode bool
-	blacklistMode bool
-	whitelist     []string
-	blacklist     []string
-	byTotal       bool
+	permitMode bool
+	dryRun     bool
+	byTotal    bool
+	moderator  policy.Moderator
+	grace      policy.Grace
+	warning    bool
+	warningMsg string
 }
 
 var (
@@ -48,15 +48,20 @@ var (
 	hostkey         *rsa.PrivateKey
 	relayState      state.RelayState
 	machineryServer *machinery.Server
+	inspector       *policy.Inspector
+	httpClient      *http.Client
 )
 var redisClient *redis.Client
 
 func main() {
 	time.Sleep(time.Second * 2)
 	initConfig()
-	sig := make(chan os.Signal)
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, os.Kill)
 	stopCtx, stopFn := context.WithCancel(context.Background())
+	if conf.moderator.Policy != nil && len(conf.moderator.Policy.BlocklistFeeds) > 0 {
+		go refreshBlocklist(stopCtx)
+	}
 	go DomainPermit(stopCtx)
 	go DomainReview(stopCtx)
 	<-sig
@@ -77,22 +82,55 @@ func initConfig() {
 		viper.BindEnv("kick_max_user")
 		viper.BindEnv("kick_min_user")
 		viper.BindEnv("by_total")
+		viper.BindEnv("policy_file")
+		viper.BindEnv("nodeinfo_cache_ttl")
+		viper.BindEnv("dry_run")
+		viper.BindEnv("kick_grace_checks")
+		viper.BindEnv("kick_grace_period")
+		viper.BindEnv("kick_warning")
+		viper.BindEnv("kick_warning_message")
+		viper.BindEnv("outbox_size")
+		viper.BindEnv("activity_ttl")
+		viper.BindEnv("audit_size")
+		for _, key := range transport.ConfigKeys {
+			viper.BindEnv(key)
+		}
 	} else {
 		Actor.Summary = viper.GetString("relay_summary")
 		Actor.Icon = activitypub.Image{URL: viper.GetString("relay_icon")}
 		Actor.Image = activitypub.Image{URL: viper.GetString("relay_image")}
 	}
-	conf.allowMaxUser = viper.GetInt("allow_max_user")
-	conf.allowMinUser = viper.GetInt("allow_min_user")
-	conf.kickMaxUser = viper.GetInt("kick_max_user")
-	conf.kickMinUser = viper.GetInt("kick_min_user")
-	conf.maxInstances = viper.GetInt("max_instances")
+	conf.moderator.Settings = policy.Settings{
+		AllowMaxUser:  viper.GetInt("allow_max_user"),
+		AllowMinUser:  viper.GetInt("allow_min_user"),
+		KickMaxUser:   viper.GetInt("kick_max_user"),
+		KickMinUser:   viper.GetInt("kick_min_user"),
+		MaxInstances:  viper.GetInt("max_instances"),
+		WhitelistMode: viper.GetBool("whitelist_mode"),
+		BlacklistMode: viper.GetBool("blacklist_mode"),
+		Whitelist:     viper.GetStringSlice("whitelist"),
+		Blacklist:     viper.GetStringSlice("blacklist"),
+	}
 	conf.byTotal = viper.GetBool("user_by_total")
 	conf.permitMode = viper.GetBool("permit_mode")
-	conf.whitelistMode = viper.GetBool("whitelist_mode")
-	conf.blacklistMode = viper.GetBool("blacklist_mode")
-	conf.whitelist = viper.GetStringSlice("whitelist")
-	conf.blacklist = viper.GetStringSlice("blacklist")
+	conf.dryRun = viper.GetBool("dry_run")
+	conf.grace = policy.Grace{
+		Checks: viper.GetInt("kick_grace_checks"),
+		Period: viper.GetDuration("kick_grace_period"),
+	}
+	conf.warning = viper.GetBool("kick_warning")
+	conf.warningMsg = viper.GetString("kick_warning_message")
+	if conf.warningMsg == "" {
+		conf.warningMsg = "Your instance will be unfollowed from this relay."
+	}
+
+	if viper.GetString("policy_file") != "" {
+		conf.moderator.Policy, err = policy.Load(viper.GetString("policy_file"))
+		if err != nil {
+			panic(err)
+		}
+		log("Auto-accept policy is loaded from " + viper.GetString("policy_file"))
+	}
 
 	Actor.Name = viper.GetString("relay_servicename")
 	log(fmt.Printf("%+v", conf))
@@ -110,6 +148,28 @@ func initConfig() {
 	}
 	redisClient = redis.NewClient(redisOption)
 	relayState = state.NewState(redisClient, false)
+	relayState.ActivityLimit = viper.GetInt("outbox_size")
+	relayState.ActivityTTL = viper.GetDuration("activity_ttl")
+	relayState.AuditLogSize = viper.GetInt("audit_size")
+	httpClient, err = transport.NewClient(transport.LoadConfig())
+	if err != nil {
+		panic(err)
+	}
+	nodeinfoCacheTTL := viper.GetDuration("nodeinfo_cache_ttl")
+	if nodeinfoCacheTTL == 0 {
+		nodeinfoCacheTTL = time.Hour
+	}
+	nodeinfoClient := nodeinfo.NewClient(redisClient, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostname.Host), nodeinfoCacheTTL)
+	nodeinfoClient.HTTPClient = httpClient
+	inspector = &policy.Inspector{
+		RedisClient: redisClient,
+		Nodeinfo:    nodeinfoClient,
+		Blocklist:   blocklist,
+		ByTotal:     conf.byTotal,
+	}
+	if conf.dryRun {
+		log("Dry-run mode is Enabled. No follow-request and subscriber is changed.")
+	}
 	if !conf.permitMode {
 		relayState.SetConfig(ManuallyAccept, false)
 		log("Manually accept follow-request is Disabled.")
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+	policy "github.com/yukimochi/Activity-Relay/Policy"
+)
+
+var blocklist = policy.NewBlocklist()
+
+// recordDecision : Store decision for domain, return true if decision is changed from last time
+func recordDecision(key string, decision policy.Decision) bool {
+	last, _ := redisClient.HMGet(key, "action", "rule").Result()
+	redisClient.HMSet(key, map[string]interface{}{
+		"action":     string(decision.Action),
+		"rule":       decision.Rule,
+		"reason":     decision.Reason,
+		"decided_at": time.Now().Unix(),
+	})
+	return len(last) != 2 || last[0] != string(decision.Action) || last[1] != decision.Rule
+}
+
+func permitFollow(domain string, decision policy.Decision) {
+	changed := recordDecision("relay:spy:decision:"+domain, decision)
+	if conf.dryRun {
+		if changed {
+			log(fmt.Sprintf("Dry-run : Instance %s Would Be %s by %s : %s", domain, decision.Action, decision.Rule, decision.Reason))
+		}
+		return
+	}
+	switch decision.Action {
+	case policy.Accept:
+		err := acceptFollow(domain, decision.Reason)
+		if err != nil {
+			log("Cannot Permit "+domain, err)
+			return
+		}
+		log(fmt.Sprintf("Instance %s Permited by %s : %s", domain, decision.Rule, decision.Reason))
+	case policy.Reject:
+		err := rejectFollow(domain, decision.Reason)
+		if err != nil {
+			log("Cannot reject "+domain, err)
+			return
+		}
+		log(fmt.Sprintf("Instance %s Rejected by %s : %s", domain, decision.Rule, decision.Reason))
+	case policy.Hold:
+		if changed {
+			log(fmt.Sprintf("Instance %s Held by %s : %s", domain, decision.Rule, decision.Reason))
+		}
+	}
+}
+
+func reviewSubscriber(subject policy.Subject, decision policy.Decision) {
+	domain := subject.Domain
+	changed := recordDecision("relay:spy:review:"+domain, decision)
+	switch decision.Action {
+	case policy.Accept:
+		inspector.ClearViolation(domain)
+		return
+	case policy.Hold:
+		return
+	}
+	violation, err := inspector.RecordViolation(domain, decision.Reason, subject.CheckedAt)
+	if err != nil {
+		log("Cannot Record Violation of "+domain, err)
+		return
+	}
+	expired := conf.grace.Expired(violation, time.Now())
+	if conf.dryRun {
+		if changed && expired {
+			log(fmt.Sprintf("Dry-run : Domain %s Would Be Kicked by %s : %s", domain, decision.Rule, decision.Reason))
+		} else if changed {
+			log(fmt.Sprintf("Dry-run : Domain %s Would Be Kicked after Grace by %s : %s", domain, decision.Rule, decision.Reason))
+		}
+		return
+	}
+	if conf.warning && !violation.Warned && inspector.MarkWarned(domain) {
+		err := warnSubscriber(domain, decision.Reason)
+		if err != nil {
+			log("Cannot Warn "+domain, err)
+		} else {
+			log(fmt.Sprintf("Domain %s Warned : %s", domain, decision.Reason))
+		}
+	}
+	if !expired {
+		if changed {
+			log(fmt.Sprintf("Domain %s Violates %s in Grace (%d checks since %s) : %s", domain, decision.Rule, violation.Count, violation.FirstAt.Format("2006-01-02 15:04:05"), decision.Reason))
+		}
+		return
+	}
+	log(fmt.Sprintf("Domain %s Should Kick by %s : %s", domain, decision.Rule, decision.Reason))
+	err = unfollowDomains(domain, decision.Reason)
+	if err != nil {
+		log("Cannot Kick "+domain, err)
+		return
+	}
+	inspector.ClearViolation(domain)
+	log(fmt.Sprintf("Kick Domain %s Succeed", domain))
+}
+
+func refreshBlocklist(stopCtx context.Context) {
+	client := &http.Client{Transport: httpClient.Transport, Timeout: time.Duration(30) * time.Second}
+	uaString := fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", viper.GetString("relay_servicename"), version, hostname.Host)
+	for {
+		err := blocklist.Refresh(client, conf.moderator.Policy.BlocklistFeeds, uaString)
+		if err != nil {
+			log("Cannot Refresh Blocklist", err)
+		} else {
+			log(fmt.Sprintf("Blocklist Refreshed,%d Domains", blocklist.Len()))
+		}
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-time.After(time.Duration(conf.moderator.Policy.BlocklistRefresh)):
+		}
+	}
+}
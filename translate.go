@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+)
+
+// DefaultAnnounceTypes : Object types announced in CreateAsAnnounce mode when announce_types is not set
+var DefaultAnnounceTypes = []string{"Note", "Question", "Article", "Page", "Event", "Video", "Audio", "Image"}
+
+// Object types of ActivityStreams vocabulary, Update and Delete of not announced one is skipped like Create
+var objectTypes = map[string]bool{
+	"Article": true, "Audio": true, "Document": true, "Event": true, "Image": true, "Note": true,
+	"Page": true, "Place": true, "Profile": true, "Question": true, "Relationship": true, "Video": true,
+}
+
+var announceTypes map[string]bool
+
+func setAnnounceTypes(types []string) {
+	if len(types) == 0 {
+		types = DefaultAnnounceTypes
+	}
+	announceTypes = map[string]bool{}
+	for _, objectType := range types {
+		announceTypes[objectType] = true
+	}
+}
+
+func errNotAnnounced(objectType string) error {
+	return fmt.Errorf("%s is not announced", objectType)
+}
+
+// translateActivity : Translate accepted activity to bodies relayed to subscribers, error means activity is skipped
+func translateActivity(activity *activitypub.Activity, body []byte) ([][]byte, error) {
+	if !relayState.RelayConfig.CreateAsAnnounce {
+		return [][]byte{body}, nil
+	}
+	switch activity.Type {
+	case "Create":
+		if len(activity.ObjectTypes()) == 0 {
+			return nil, errors.New("Object of Create is not embedded")
+		}
+		nestedObject, err := activity.NestedActivity()
+		if err != nil {
+			return nil, errors.New("Fail Assert activity : " + err.Error())
+		}
+		if !announceTypes[nestedObject.Type] {
+			return nil, errNotAnnounced(nestedObject.Type)
+		}
+		resp := nestedObject.GenerateAnnounce(hostURL)
+		err = relayState.AddAnnounce(nestedObject.ID, resp.ID, string(activity.Actor))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return [][]byte{storeActivity(&resp, true)}, nil
+	case "Update", "Delete":
+		for _, objectType := range activity.ObjectTypes() {
+			if objectTypes[objectType] && !announceTypes[objectType] {
+				return nil, errNotAnnounced(objectType)
+			}
+		}
+		if activity.Type == "Delete" {
+			var bodies [][]byte
+			for _, objectID := range activity.ObjectIDs() {
+				bodies = append(bodies, undoAnnounce(objectID, string(activity.Actor))...)
+			}
+			return append(bodies, body), nil
+		}
+	}
+	return [][]byte{body}, nil
+}
+
+// undoAnnounce : Undo relay's Announce of object deleted by actor who created it, subscribers which only saw Announce remove it
+func undoAnnounce(objectID string, actorID string) [][]byte {
+	if objectID == "" {
+		return nil
+	}
+	announceID, announcedActorID, err := relayState.SelectAnnounce(objectID)
+	if err != nil || announcedActorID != actorID {
+		return nil
+	}
+	relayState.DelAnnounce(objectID)
+	announce := activitypub.Activity{
+		ID:     announceID,
+		Actor:  activitypub.Link(hostURL.String() + "/actor"),
+		Type:   "Announce",
+		Object: activitypub.LinkTo(objectID),
+		To:     []string{hostURL.String() + "/actor/followers"},
+	}
+	resp := announce.GenerateUndo(hostURL)
+	return [][]byte{storeActivity(&resp, true)}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
+)
+
+func TestTranslateActivity(t *testing.T) {
+	activity := mockActivity("Create-Article")
+	body, _ := json.Marshal(&activity)
+
+	translated, err := translateActivity(&activity, body)
+	if err != nil || len(translated) != 1 || string(translated[0]) != string(body) {
+		t.Fatalf("Failed - Activity translated without CreateAsAnnounce.")
+	}
+
+	relayState.SetConfig(CreateAsAnnounce, true)
+	defer relayState.SetConfig(CreateAsAnnounce, false)
+
+	translated, err = translateActivity(&activity, body)
+	if err != nil {
+		t.Fatalf("Failed - " + err.Error())
+	}
+	var announce activitypub.Activity
+	json.Unmarshal(translated[0], &announce)
+	if announce.Type != "Announce" || announce.ObjectID() != "https://mastodon.test.yukimochi.io/users/yukimochi/statuses/101075045564444857" {
+		t.Fatalf("Failed - Article not announced.")
+	}
+
+	setAnnounceTypes([]string{"Note"})
+	defer setAnnounceTypes(nil)
+	_, err = translateActivity(&activity, body)
+	if err == nil {
+		t.Fatalf("Failed - Not configured type announced.")
+	}
+}
+
+func TestTranslateActivityUpdateDelete(t *testing.T) {
+	relayState.SetConfig(CreateAsAnnounce, true)
+	defer relayState.SetConfig(CreateAsAnnounce, false)
+	setAnnounceTypes([]string{"Note"})
+	defer setAnnounceTypes(nil)
+
+	update := activitypub.Activity{Type: "Update", Object: activitypub.Embed(map[string]interface{}{"id": "https://example.com/articles/1", "type": "Article"})}
+	_, err := translateActivity(&update, []byte("update"))
+	if err == nil {
+		t.Fatalf("Failed - Update of not announced type relayed.")
+	}
+	update.Object = activitypub.Embed(map[string]interface{}{"id": "https://example.com/users/example", "type": "Person"})
+	translated, err := translateActivity(&update, []byte("update"))
+	if err != nil || len(translated) != 1 || string(translated[0]) != "update" {
+		t.Fatalf("Failed - Update of actor not relayed.")
+	}
+	remove := activitypub.Activity{Type: "Delete", Object: activitypub.LinkTo("https://example.com/notes/1")}
+	translated, err = translateActivity(&remove, []byte("delete"))
+	if err != nil || len(translated) != 1 || string(translated[0]) != "delete" {
+		t.Fatalf("Failed - Delete not relayed.")
+	}
+}
+
+func TestTranslateActivityUndoAnnounce(t *testing.T) {
+	relayState.SetConfig(CreateAsAnnounce, true)
+	defer relayState.SetConfig(CreateAsAnnounce, false)
+
+	activity := mockActivity("Create-Article")
+	body, _ := json.Marshal(&activity)
+	translated, _ := translateActivity(&activity, body)
+	var announce activitypub.Activity
+	json.Unmarshal(translated[0], &announce)
+
+	remove := activitypub.Activity{Type: "Delete", Actor: "https://other.yukimochi.example.org/users/other", Object: activitypub.Embed(map[string]interface{}{"id": announce.ObjectID(), "type": "Tombstone"})}
+	translated, err := translateActivity(&remove, []byte("delete"))
+	if err != nil || len(translated) != 1 {
+		t.Fatalf("Failed - Undo of Announce relayed with Delete by other actor.")
+	}
+
+	remove.Actor = activity.Actor
+	translated, err = translateActivity(&remove, []byte("delete"))
+	if err != nil || len(translated) != 2 || string(translated[1]) != "delete" {
+		t.Fatalf("Failed - Undo of Announce not relayed with Delete.")
+	}
+	var undo struct {
+		Type   string
+		Object activitypub.Activity
+	}
+	json.Unmarshal(translated[0], &undo)
+	if undo.Type != "Undo" || undo.Object.Type != "Announce" || undo.Object.ID != announce.ID || undo.Object.ObjectID() != announce.ObjectID() {
+		t.Fatalf("Failed - Invalid Undo of Announce.")
+	}
+
+	translated, _ = translateActivity(&remove, []byte("delete"))
+	if len(translated) != 1 {
+		t.Fatalf("Failed - Undo of Announce relayed twice.")
+	}
+
+	translated, _ = translateActivity(&activity, body)
+	json.Unmarshal(translated[0], &announce)
+	remove = activitypub.Activity{Type: "Delete", Actor: activity.Actor, Object: activitypub.LinkTo("https://example.com/notes/1", announce.ObjectID())}
+	translated, _ = translateActivity(&remove, []byte("delete"))
+	if len(translated) != 2 {
+		t.Fatalf("Failed - Undo of Announce not relayed with Delete of array.")
+	}
+
+	relayState.RedisClient.FlushAll().Result()
+	relayState.Load()
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/rsa"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
@@ -11,11 +13,15 @@ import (
 	"github.com/RichardKnop/machinery/v1"
 	"github.com/RichardKnop/machinery/v1/config"
 	"github.com/RichardKnop/machinery/v1/log"
+	"github.com/RichardKnop/machinery/v1/tasks"
 	"github.com/go-redis/redis"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/viper"
 	activitypub "github.com/yukimochi/Activity-Relay/ActivityPub"
 	keyloader "github.com/yukimochi/Activity-Relay/KeyLoader"
+	ratelimit "github.com/yukimochi/Activity-Relay/RateLimit"
+	state "github.com/yukimochi/Activity-Relay/State"
+	transport "github.com/yukimochi/Activity-Relay/Transport"
 )
 
 var (
@@ -29,14 +35,118 @@ var (
 	redisClient     *redis.Client
 	machineryServer *machinery.Server
 	httpClient      *http.Client
+	relayState      state.RelayState
+	limiter         *ratelimit.Limiter
+
+	defaultDeliveryLimit state.DeliveryLimit
+)
+
+const (
+	// Delivery slot is reclaimed after deliveryLease even if worker is crashed while sending
+	deliveryLease = 30 * time.Second
+	// Delivery to paused domain is checked again after pausedRetry
+	pausedRetry = time.Minute
 )
 
-func relayActivity(args ...string) error {
+func paused(host string) bool {
+	for _, domain := range relayState.PausedDomains {
+		if domain == host {
+			return true
+		}
+	}
+	return false
+}
+
+func deliveryLimit(host string) state.DeliveryLimit {
+	subscription := relayState.SelectSubscription(host)
+	if subscription != nil && subscription.DeliveryLimit != nil {
+		return *subscription.DeliveryLimit
+	}
+	return defaultDeliveryLimit
+}
+
+// throttle : Take delivery slot and token of host, return tasks.ErrRetryTaskLater if host is paused or busy
+func throttle(host string) (func(), error) {
+	if paused(host) {
+		return nil, tasks.NewErrRetryTaskLater(host+" is paused", pausedRetry)
+	}
+	limit := deliveryLimit(host)
+	release := func() {}
+	if limit.Concurrency > 0 {
+		token, err := limiter.Acquire(host, limit.Concurrency, deliveryLease)
+		if err == nil && token == "" {
+			retryIn := time.Second + time.Duration(rand.Int63n(int64(time.Second)))
+			return nil, tasks.NewErrRetryTaskLater(host+" reached concurrency limit", retryIn)
+		}
+		release = func() { limiter.Release(host, token) }
+	}
+	if limit.Rate > 0 {
+		allowed, wait, _ := limiter.Allow("delivery:"+host, limit.Rate, limit.Burst)
+		if !allowed {
+			release()
+			return nil, tasks.NewErrRetryTaskLater(host+" reached rate limit", wait)
+		}
+	}
+	return release, nil
+}
+
+// countAttempt : Count delivery attempt in signature header, which is kept on retry
+func countAttempt(signature *tasks.Signature) int {
+	if signature == nil {
+		return 1
+	}
+	if signature.Headers == nil {
+		signature.Headers = tasks.Headers{}
+	}
+	attempts := 0
+	switch count := signature.Headers["attempts"].(type) {
+	case float64:
+		attempts = int(count)
+	case int:
+		attempts = count
+	}
+	attempts++
+	signature.Headers["attempts"] = attempts
+	return attempts
+}
+
+// deliver : Send activity, job is stored in dead-letter store when machinery gives up it
+func deliver(ctx context.Context, task string, inboxURL string, body string) error {
+	signature := tasks.SignatureFromContext(ctx)
+	attempts := countAttempt(signature)
+	err := sendActivity(inboxURL, Actor.ID, []byte(body), hostPrivatekey)
+	if err != nil && (signature == nil || signature.RetryCount == 0) {
+		letter := state.DeadLetter{
+			ID:       uuid.NewV4().String(),
+			Task:     task,
+			InboxURL: inboxURL,
+			Error:    err.Error(),
+			Attempts: attempts,
+		}
+		if signature != nil {
+			letter.ID = signature.UUID
+		}
+		if domain, parseErr := url.Parse(inboxURL); parseErr == nil {
+			letter.Domain = domain.Host
+		}
+		if dlqErr := relayState.AddDeadLetter(letter, []byte(body)); dlqErr != nil {
+			fmt.Fprintln(os.Stderr, dlqErr)
+		}
+	}
+	return err
+}
+
+func relayActivity(ctx context.Context, args ...string) error {
 	inboxURL := args[0]
 	body := args[1]
-	err := sendActivity(inboxURL, Actor.ID, []byte(body), hostPrivatekey)
+	domain, _ := url.Parse(inboxURL)
+	release, err := throttle(domain.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = deliver(ctx, "relay", inboxURL, body)
 	if err != nil {
-		domain, _ := url.Parse(inboxURL)
 		mod, _ := redisClient.HSetNX("relay:statistics:"+domain.Host, "last_error", err.Error()).Result()
 		if mod {
 			redisClient.Expire("relay:statistics:"+domain.Host, time.Duration(time.Minute))
@@ -45,10 +155,16 @@ func relayActivity(args ...string) error {
 	return err
 }
 
-func registorActivity(args ...string) error {
+func registorActivity(ctx context.Context, args ...string) error {
 	inboxURL := args[0]
 	body := args[1]
-	err := sendActivity(inboxURL, Actor.ID, []byte(body), hostPrivatekey)
+	domain, _ := url.Parse(inboxURL)
+	release, err := throttle(domain.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = deliver(ctx, "registor", inboxURL, body)
 	return err
 }
 
@@ -63,6 +179,15 @@ func initConfig() {
 		viper.BindEnv("relay_bind")
 		viper.BindEnv("relay_domain")
 		viper.BindEnv("relay_servicename")
+		viper.BindEnv("worker_concurrency")
+		viper.BindEnv("delivery_concurrency")
+		viper.BindEnv("delivery_rate")
+		viper.BindEnv("delivery_burst")
+		viper.BindEnv("dlq_size")
+		viper.BindEnv("dlq_ttl")
+		for _, key := range transport.ConfigKeys {
+			viper.BindEnv(key)
+		}
 	} else {
 		Actor.Summary = viper.GetString("relay_summary")
 		Actor.Icon = activitypub.Image{URL: viper.GetString("relay_icon")}
@@ -77,6 +202,16 @@ func initConfig() {
 		panic(err)
 	}
 	redisClient = redis.NewClient(redisOption)
+	relayState = state.NewState(redisClient, true)
+	relayState.DeadLetterLimit = viper.GetInt("dlq_size")
+	relayState.DeadLetterTTL = viper.GetDuration("dlq_ttl")
+	relayState.ListenNotify(nil)
+	limiter = ratelimit.NewLimiter(redisClient)
+	defaultDeliveryLimit = state.DeliveryLimit{
+		Concurrency: viper.GetInt("delivery_concurrency"),
+		Rate:        viper.GetFloat64("delivery_rate"),
+		Burst:       viper.GetInt("delivery_burst"),
+	}
 	machineryConfig := &config.Config{
 		Broker:          viper.GetString("redis_url"),
 		DefaultQueue:    "relay",
@@ -87,7 +222,14 @@ func initConfig() {
 	if err != nil {
 		panic(err)
 	}
-	httpClient = &http.Client{Timeout: time.Duration(5) * time.Second}
+	transportConfig := transport.LoadConfig()
+	if transportConfig.Timeout == 0 {
+		transportConfig.Timeout = time.Duration(5) * time.Second
+	}
+	httpClient, err = transport.NewClient(transportConfig)
+	if err != nil {
+		panic(err)
+	}
 
 	Actor.GenerateSelfKey(hostURL, &hostPrivatekey.PublicKey)
 	newNullLogger := NewNullLogger()
@@ -97,6 +239,7 @@ func initConfig() {
 	fmt.Println(" - Configurations")
 	fmt.Println("RELAY DOMAIN : ", hostURL.Host)
 	fmt.Println("REDIS URL : ", viper.GetString("redis_url"))
+	fmt.Println("DELIVERY LIMIT PER HOST : ", defaultDeliveryLimit.Concurrency, "concurrency,", defaultDeliveryLimit.Rate, "requests per second")
 }
 
 func main() {
@@ -112,7 +255,11 @@ func main() {
 	}
 
 	workerID := uuid.NewV4()
-	worker := machineryServer.NewWorker(workerID.String(), 200)
+	concurrency := viper.GetInt("worker_concurrency")
+	if concurrency == 0 {
+		concurrency = 200
+	}
+	worker := machineryServer.NewWorker(workerID.String(), concurrency)
 	err = worker.Launch()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -1,19 +1,24 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/RichardKnop/machinery/v1/tasks"
 	"github.com/spf13/viper"
+	state "github.com/yukimochi/Activity-Relay/State"
 )
 
 func TestMain(m *testing.M) {
 	viper.Set("actor_pem", "../misc/testKey.pem")
 	viper.Set("relay_domain", "relay.yukimochi.example.org")
+	viper.Set("http_allowlist", []string{"127.0.0.0/8"})
 	initConfig()
 	redisClient.FlushAll().Result()
 
@@ -36,7 +41,7 @@ func TestRelayActivity(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := relayActivity(s.URL, "data")
+	err := relayActivity(context.Background(), s.URL, "data")
 	if err != nil {
 		t.Fatal("Failed - Data transfar not collect")
 	}
@@ -48,7 +53,7 @@ func TestRelayActivityNoHost(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := relayActivity("http://nohost.example.jp", "data")
+	err := relayActivity(context.Background(), "http://nohost.example.jp", "data")
 	if err == nil {
 		t.Fatal("Failed - Error not reported.")
 	}
@@ -66,7 +71,7 @@ func TestRelayActivityResp500(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := relayActivity(s.URL, "data")
+	err := relayActivity(context.Background(), s.URL, "data")
 	if err == nil {
 		t.Fatal("Failed - Error not reported.")
 	}
@@ -90,7 +95,7 @@ func TestRegistorActivity(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := registorActivity(s.URL, "data")
+	err := registorActivity(context.Background(), s.URL, "data")
 	if err != nil {
 		t.Fatal("Failed - Data transfar not collect")
 	}
@@ -102,7 +107,7 @@ func TestRegistorActivityNoHost(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := registorActivity("http://nohost.example.jp", "data")
+	err := registorActivity(context.Background(), "http://nohost.example.jp", "data")
 	if err == nil {
 		t.Fatal("Failed - Error not reported.")
 	}
@@ -115,8 +120,110 @@ func TestRegistorActivityResp500(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := registorActivity(s.URL, "data")
+	err := registorActivity(context.Background(), s.URL, "data")
 	if err == nil {
 		t.Fatal("Failed - Error not reported.")
 	}
 }
+
+func TestRelayActivityConcurrencyLimit(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write(nil)
+	}))
+	defer s.Close()
+	domain, _ := url.Parse(s.URL)
+
+	defaultDeliveryLimit = state.DeliveryLimit{Concurrency: 1}
+	defer func() { defaultDeliveryLimit = state.DeliveryLimit{} }()
+
+	token, _ := limiter.Acquire(domain.Host, 1, time.Minute)
+	err := relayActivity(context.Background(), s.URL, "data")
+	if _, ok := err.(tasks.ErrRetryTaskLater); !ok {
+		t.Fatal("Failed - Busy host not retried later.")
+	}
+	data, _ := redisClient.HGet("relay:statistics:"+domain.Host, "last_error").Result()
+	if data != "" {
+		t.Fatal("Failed - Throttled delivery cached as error.")
+	}
+	limiter.Release(domain.Host, token)
+	err = relayActivity(context.Background(), s.URL, "data")
+	if err != nil {
+		t.Fatal("Failed - Released slot not used.")
+	}
+	redisClient.FlushAll().Result()
+}
+
+func TestRelayActivitySubscriberRateLimit(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write(nil)
+	}))
+	defer s.Close()
+	domain, _ := url.Parse(s.URL)
+
+	relayState.AddSubscription(state.Subscription{
+		Domain:   domain.Host,
+		InboxURL: s.URL,
+	})
+	relayState.SetDeliveryLimit(domain.Host, state.DeliveryLimit{Rate: 0.01, Burst: 1}, true)
+	relayState.Load()
+
+	err := relayActivity(context.Background(), s.URL, "data")
+	if err != nil {
+		t.Fatal("Failed - Delivery in burst not sent.")
+	}
+	err = registorActivity(context.Background(), s.URL, "data")
+	retry, ok := err.(tasks.ErrRetryTaskLater)
+	if !ok || retry.RetryIn() <= 0 {
+		t.Fatal("Failed - Delivery over rate not retried later.")
+	}
+	redisClient.FlushAll().Result()
+	relayState.Load()
+}
+
+func TestRegistorActivityDeadLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		w.Write(nil)
+	}))
+	defer s.Close()
+
+	signature := &tasks.Signature{UUID: "task_test", Name: "registor", RetryCount: 1, Headers: tasks.Headers{"attempts": float64(2)}}
+	task, _ := tasks.NewWithSignature(registorActivity, signature)
+	registorActivity(task.Context, s.URL, "data")
+	letters, _ := relayState.ListDeadLetters("")
+	if len(letters) != 0 {
+		t.Fatal("Failed - Job to be retried is stored as dead letter.")
+	}
+
+	signature.RetryCount = 0
+	registorActivity(task.Context, s.URL, "data")
+	letter, body, err := relayState.SelectDeadLetter("task_test")
+	if err != nil {
+		t.Fatal("Failed - Given up job is not stored as dead letter.")
+	}
+	if letter.Task != "registor" || letter.InboxURL != s.URL || letter.Attempts != 4 || string(body) != "data" {
+		t.Fatal("Failed - Dead letter is invalid.")
+	}
+	redisClient.FlushAll().Result()
+}
+
+func TestRelayActivityPaused(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Failed - Activity delivered to paused domain.")
+	}))
+	defer s.Close()
+	domain, _ := url.Parse(s.URL)
+
+	relayState.SetPausedDomain(domain.Host, true)
+	relayState.Load()
+
+	err := relayActivity(context.Background(), s.URL, "data")
+	retry, ok := err.(tasks.ErrRetryTaskLater)
+	if !ok || retry.RetryIn() != pausedRetry {
+		t.Fatal("Failed - Delivery to paused domain not retried later.")
+	}
+	redisClient.FlushAll().Result()
+	relayState.Load()
+}